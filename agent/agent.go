@@ -1,13 +1,31 @@
 package agent
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 
 	client "github.com/seashell/agent/client"
+	adapter "github.com/seashell/agent/client/adapter/http"
+	middleware "github.com/seashell/agent/client/adapter/http/middleware"
+	cron "github.com/seashell/agent/pkg/cron"
+	http "github.com/seashell/agent/pkg/http"
 	log "github.com/seashell/agent/pkg/log"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// httpShutdownTimeout is how long the local HTTP API waits
+	// for the requests being served when shutting down
+	httpShutdownTimeout = 5 * time.Second
 )
 
 // Agent :
@@ -16,6 +34,8 @@ type Agent struct {
 	logger log.Logger
 	client *client.Client
 
+	httpServer *http.Server
+
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
@@ -42,6 +62,11 @@ func New(config *Config, logger log.Logger) (*Agent, error) {
 		return nil, err
 	}
 
+	// Setup local HTTP API
+	if err := a.setupHTTPServer(); err != nil {
+		return nil, err
+	}
+
 	return a, nil
 }
 
@@ -55,6 +80,17 @@ func (a *Agent) Shutdown() error {
 	}
 
 	a.logger.Infof("requesting shutdown")
+
+	// The local HTTP API is stopped first, so that requests
+	// are not served by a client which is shutting down
+	if a.httpServer != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		if err := a.httpServer.Shutdown(ctx); err != nil {
+			a.logger.Errorf("http server shutdown failed: %s", err.Error())
+		}
+		cancel()
+	}
+
 	if a.client != nil {
 		if err := a.client.Shutdown(); err != nil {
 			a.logger.Errorf("client shutdown failed: %s", err.Error())
@@ -87,34 +123,274 @@ func (a *Agent) setupClient() error {
 	return nil
 }
 
-// clientConfig creates a new client.Config struct based on an
+// Setup the local HTTP API, which exposes the client status and allows
+// for managing local configuration overrides and the client state
+func (a *Agent) setupHTTPServer() error {
+
+	logger := a.logger.WithName("http")
+
+	token, err := writeAPIToken(APITokenPath(a.config))
+	if err != nil {
+		return fmt.Errorf("http server setup failed: %v", err)
+	}
+
+	server, err := http.NewServer(&http.Config{
+		BindAddress: a.config.HTTPAddr,
+		Logger:      logger,
+		Handlers: map[string]http.Handler{
+			"/v1/status":       adapter.NewStatusHandler(a.client),
+			"/v1/overrides":    adapter.NewOverridesHandler(a.client),
+			"/v1/metrics":      adapter.NewMetricsHandler(a.client),
+			"/v1/state":        adapter.NewStateHandler(a.client),
+			"/v1/state/":       adapter.NewStateHandler(a.client),
+			"/v1/maintenance":  adapter.NewMaintenanceHandler(a.client),
+			"/v1/maintenance/": adapter.NewMaintenanceHandler(a.client),
+		},
+		Middleware: []http.Middleware{
+			middleware.Token(token),
+			middleware.Logging(logger),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("http server setup failed: %v", err)
+	}
+
+	a.httpServer = server
+
+	return nil
+}
+
+// APITokenPath returns the path of the file containing the token
+// required by the local HTTP API, which only root can read
+func APITokenPath(config *Config) string {
+	return path.Join(config.DataDir, apiTokenFile)
+}
+
+// LoadAPIToken reads the token required by the local HTTP API
+// of a running agent
+func LoadAPIToken(config *Config) (string, error) {
+
+	token, err := ioutil.ReadFile(APITokenPath(config))
+	if err != nil {
+		return "", fmt.Errorf("could not read the local API token: %v", err)
+	}
+
+	return strings.TrimSpace(string(token)), nil
+}
+
+// writeAPIToken generates a new token for the local HTTP API, and
+// writes it to a file readable by its owner only
+func writeAPIToken(p string) (string, error) {
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate the local API token: %v", err)
+	}
+
+	token := hex.EncodeToString(b)
+
+	if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+		return "", fmt.Errorf("could not create directory: %v", err)
+	}
+
+	// The file is removed first, so that it is created with the expected
+	// mode even if a file with broader permissions already exists
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("could not replace the local API token: %v", err)
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("could not write the local API token: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(token + "\n"); err != nil {
+		return "", fmt.Errorf("could not write the local API token: %v", err)
+	}
+
+	return token, nil
+}
+
+// clientConfig creates a new client.Config struct based on the
+// agent configuration
+func (a *Agent) clientConfig() (*client.Config, error) {
+	return NewClientConfig(a.config, a.logger)
+}
+
+// NewClientConfig creates a new client.Config struct based on an
 // agent.Config struct and which can be used to initialize
 // a Seashell client
-func (a *Agent) clientConfig() (*client.Config, error) {
+func NewClientConfig(config *Config, logger log.Logger) (*client.Config, error) {
 
 	c := client.DefaultConfig()
 
-	c.OrganizationID = a.config.Client.OrganizationID
-	c.ProjectID = a.config.Client.ProjectID
-	c.DeviceBatchID = a.config.Client.BatchID
-	c.DeviceID = a.config.Client.DeviceID
-	c.DeviceSecret = a.config.Client.SecretID
+	c.OrganizationID = config.Client.OrganizationID
+	c.ProjectID = config.Client.ProjectID
+	c.DeviceBatchID = config.Client.BatchID
+	c.DeviceID = config.Client.DeviceID
+	c.DeviceSecret = config.Client.SecretID
+
+	c.APIAddr = config.APIAddr
+	c.StateDir = config.Client.StateDir
+	if config.Client.StateBackend != "" {
+		c.StateBackend = config.Client.StateBackend
+	}
+	if config.Client.StateRecovery != "" {
+		c.StateRecovery = config.Client.StateRecovery
+	}
+	c.OutputDir = config.Client.OutputDir
+	c.Meta = config.Client.Meta
+	if config.Client.HistorySize != 0 {
+		c.HistorySize = config.Client.HistorySize
+	}
+	if c.HistorySize < 1 {
+		return nil, fmt.Errorf("invalid history_size %d: at least one version must be kept", c.HistorySize)
+	}
+	c.OverrideFile = config.Client.OverrideFile
+	c.FileRoots = config.Client.FileRoots
+	c.DriftReportOnly = config.Client.DriftReportOnly
+	c.AllowRemoteHooks = config.Client.AllowRemoteHooks
+
+	if config.Client.HeartbeatIntervalSeconds != 0 {
+		c.HeartbeatInterval = config.Client.HeartbeatIntervalSeconds * time.Second
+	}
+
+	if r := config.Client.ContainerRuntime; r != nil {
+		c.ContainerRuntime = c.ContainerRuntime.Merge(&client.ContainerRuntimeConfig{
+			DaemonConfigPath: r.DaemonConfigPath,
+			SocketPath:       r.SocketPath,
+			RestartCommand:   r.RestartCommand,
+		})
+	}
+
+	for _, h := range config.Client.Hooks {
+		hook := &structs.Hook{
+			Name:     h.Name,
+			Trigger:  h.Trigger,
+			Module:   h.Module,
+			Command:  h.Command,
+			Interval: h.Interval,
+			Timeout:  h.Timeout,
+			Env:      h.Env,
+			Source:   structs.HookSourceLocal,
+		}
+		if err := hook.Validate(); err != nil {
+			return nil, err
+		}
+		c.Hooks = append(c.Hooks, hook)
+	}
+
+	if d := config.Client.Drago; d != nil {
+		c.Drago = c.Drago.Merge(&client.DragoConfig{
+			WireguardPath:     d.WireguardPath,
+			WireguardToolPath: d.WireguardToolPath,
+			InterfacePrefix:   d.InterfacePrefix,
+			ListenPort:        d.ListenPort,
+		})
+	}
+
+	if f := config.Client.Facts; f != nil {
+		facts := &client.FactsConfig{Dir: f.Dir}
+		if f.TTL != "" {
+			ttl, err := time.ParseDuration(f.TTL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid facts ttl: %v", err)
+			}
+			facts.TTL = ttl
+		}
+		if f.Timeout != "" {
+			timeout, err := time.ParseDuration(f.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid facts timeout: %v", err)
+			}
+			facts.Timeout = timeout
+		}
+		c.Facts = c.Facts.Merge(facts)
+	}
 
-	c.APIAddr = a.config.APIAddr
-	c.StateDir = a.config.Client.StateDir
-	c.OutputDir = a.config.Client.OutputDir
-	c.Meta = a.config.Client.Meta
+	if u := config.Client.SelfUpdate; u != nil {
+		update := &client.SelfUpdateConfig{
+			PublicKey:  u.PublicKey,
+			BinaryPath: u.BinaryPath,
+		}
+		if u.ReadyTimeout != "" {
+			timeout, err := time.ParseDuration(u.ReadyTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid self_update ready_timeout: %v", err)
+			}
+			update.ReadyTimeout = timeout
+		}
+		c.SelfUpdate = c.SelfUpdate.Merge(update)
+	}
+
+	for _, w := range config.MaintenanceWindows {
+		window, err := maintenanceWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window %q: %v", w.Schedule, err)
+		}
+		c.MaintenanceWindows = append(c.MaintenanceWindows, window)
+	}
+
+	for _, v := range config.Client.Validators {
+		validator := &client.ValidatorConfig{
+			Command:  v.Command,
+			ParseHCL: v.HCL,
+		}
+		if v.Timeout != "" {
+			timeout, err := time.ParseDuration(v.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for %s validator: %v", v.Module, err)
+			}
+			validator.Timeout = timeout
+		}
+		c.Validators[v.Module] = validator
+	}
 
 	if c.StateDir == "" {
-		c.StateDir = a.config.DataDir
+		c.StateDir = config.DataDir
 	}
 
 	if c.OutputDir == "" {
-		c.OutputDir = path.Join(a.config.DataDir, "output")
+		c.OutputDir = path.Join(config.DataDir, "output")
+	}
+
+	if c.Facts.Dir == "" {
+		c.Facts.Dir = path.Join(config.DataDir, "facts.d")
 	}
 
-	c.LogLevel = a.config.LogLevel
-	c.Logger = a.logger
+	c.LogLevel = config.LogLevel
+	c.Logger = logger
 
 	return c, nil
 }
+
+// maintenanceWindow parses the configuration of a maintenance window
+func maintenanceWindow(w *MaintenanceWindowConfig) (*client.MaintenanceWindow, error) {
+
+	schedule, err := cron.Parse(w.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration: %v", err)
+	}
+	if duration < time.Minute {
+		return nil, fmt.Errorf("duration must be at least one minute")
+	}
+
+	location := client.SystemLocation()
+	if w.Timezone != "" {
+		if location, err = time.LoadLocation(w.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %v", err)
+		}
+	}
+
+	return &client.MaintenanceWindow{
+		Schedule: schedule,
+		Duration: duration,
+		Location: location,
+	}, nil
+}
@@ -5,13 +5,17 @@ import (
 	"path"
 	"time"
 
-	"github.com/hashicorp/hcl/v2/hclsimple"
 	"github.com/seashell/agent/version"
 )
 
 const (
-	defaultDataDir = "/tmp/seashell"
-	defaultAPIAddr = "https://api.seashell.sh"
+	defaultDataDir  = "/tmp/seashell"
+	defaultAPIAddr  = "https://api.seashell.sh"
+	defaultHTTPAddr = "127.0.0.1:5345"
+
+	// apiTokenFile is the file, within the data directory, containing
+	// the token required by the local HTTP API
+	apiTokenFile = "api.token"
 )
 
 // Config contains configurations for the Seashell agent
@@ -29,6 +33,12 @@ type Config struct {
 	// LogLevel is the level of the logs to put out
 	LogLevel string `hcl:"log_level,optional"`
 
+	// HTTPAddr is the address on which the agent's local HTTP API listens
+	HTTPAddr string `hcl:"http_addr,optional"`
+
+	// MaintenanceWindows restrict when configuration changes are applied
+	MaintenanceWindows []*MaintenanceWindowConfig `hcl:"maintenance_window,block"`
+
 	// Client contains all client-specific configurations
 	Client *ClientConfig `hcl:"client,block"`
 
@@ -57,6 +67,12 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.LogLevel != "" {
 		result.LogLevel = b.LogLevel
 	}
+	if b.HTTPAddr != "" {
+		result.HTTPAddr = b.HTTPAddr
+	}
+	if b.MaintenanceWindows != nil {
+		result.MaintenanceWindows = b.MaintenanceWindows
+	}
 
 	// Apply the client config
 	if result.Client == nil && b.Client != nil {
@@ -69,6 +85,21 @@ func (c *Config) Merge(b *Config) *Config {
 	return &result
 }
 
+// MaintenanceWindowConfig contains the configuration of a recurring
+// window during which configuration changes are applied
+type MaintenanceWindowConfig struct {
+
+	// Schedule is a cron expression of when the window opens, e.g. "0 2 * * *"
+	Schedule string `hcl:"schedule"`
+
+	// Duration is how long the window stays open, e.g. "2h"
+	Duration string `hcl:"duration"`
+
+	// Timezone is the IANA time zone in which the schedule is
+	// evaluated, e.g. "Europe/Berlin". It defaults to the system's.
+	Timezone string `hcl:"timezone,optional"`
+}
+
 // ClientConfig contains configurations for the Seashell client
 type ClientConfig struct {
 
@@ -78,6 +109,13 @@ type ClientConfig struct {
 	// StateDir is the directory used by the client to store its state
 	StateDir string `hcl:"state_dir,optional"`
 
+	// StateBackend is where the client state is stored, i.e. "boltdb" or "inmem"
+	StateBackend string `hcl:"state_backend,optional"`
+
+	// StateRecovery is how a corrupted client state is recovered from,
+	// i.e. "none", "reset" or "restore"
+	StateRecovery string `hcl:"state_recovery,optional"`
+
 	// OutputDir is the directory to which the client renders the configuration
 	OutputDir string `hcl:"output_dir,optional"`
 
@@ -102,6 +140,40 @@ type ClientConfig struct {
 	// Meta contains metadata about the client node
 	Meta map[string]string `hcl:"meta,optional"`
 
+	// Validators contains the post-render validators of each module
+	Validators []*ValidatorConfig `hcl:"validator,block"`
+
+	// HistorySize is the number of configuration versions kept for each module.
+	// It must be at least 1, and defaults to 10 if unset.
+	HistorySize int `hcl:"history_size,optional"`
+
+	// OverrideFile is the path to an HCL file overriding the remote configuration
+	OverrideFile string `hcl:"override_file,optional"`
+
+	// DriftReportOnly causes drift in rendered files to be reported, but not repaired
+	DriftReportOnly bool `hcl:"drift_report_only,optional"`
+
+	// Hooks contains the commands run on configuration changes, on start or periodically
+	Hooks []*HookConfig `hcl:"hook,block"`
+
+	// AllowRemoteHooks allows for hooks received from the API to be run
+	AllowRemoteHooks bool `hcl:"allow_remote_hooks,optional"`
+
+	// FileRoots are the directories under which files can be managed
+	FileRoots []string `hcl:"file_roots,optional"`
+
+	// Drago contains the local settings of the drago module
+	Drago *DragoConfig `hcl:"drago,block"`
+
+	// ContainerRuntime contains the local settings of the runtime module
+	ContainerRuntime *ContainerRuntimeConfig `hcl:"container_runtime,block"`
+
+	// Facts contains the settings of custom facts
+	Facts *FactsConfig `hcl:"facts,block"`
+
+	// SelfUpdate contains the settings of agent self-updates
+	SelfUpdate *SelfUpdateConfig `hcl:"self_update,block"`
+
 	// SyncInterval controls how frequently the client synchronizes its state
 	SyncIntervalSeconds time.Duration `hcl:"sync_interval,optional"`
 
@@ -123,6 +195,12 @@ func (c *ClientConfig) Merge(b *ClientConfig) *ClientConfig {
 	if b.StateDir != "" {
 		result.StateDir = b.StateDir
 	}
+	if b.StateBackend != "" {
+		result.StateBackend = b.StateBackend
+	}
+	if b.StateRecovery != "" {
+		result.StateRecovery = b.StateRecovery
+	}
 	if b.OrganizationID != "" {
 		result.OrganizationID = b.OrganizationID
 	}
@@ -147,10 +225,234 @@ func (c *ClientConfig) Merge(b *ClientConfig) *ClientConfig {
 	if b.Meta != nil {
 		result.Meta = b.Meta
 	}
+	if b.Validators != nil {
+		result.Validators = b.Validators
+	}
+	if b.HistorySize != 0 {
+		result.HistorySize = b.HistorySize
+	}
+	if b.DriftReportOnly {
+		result.DriftReportOnly = true
+	}
+	if b.OverrideFile != "" {
+		result.OverrideFile = b.OverrideFile
+	}
+	if b.HeartbeatIntervalSeconds != 0 {
+		result.HeartbeatIntervalSeconds = b.HeartbeatIntervalSeconds
+	}
+	if b.Hooks != nil {
+		result.Hooks = b.Hooks
+	}
+	if b.AllowRemoteHooks {
+		result.AllowRemoteHooks = true
+	}
+	if b.FileRoots != nil {
+		result.FileRoots = b.FileRoots
+	}
+	if result.Drago == nil && b.Drago != nil {
+		drago := *b.Drago
+		result.Drago = &drago
+	} else if b.Drago != nil {
+		result.Drago = result.Drago.Merge(b.Drago)
+	}
+	if result.Facts == nil && b.Facts != nil {
+		facts := *b.Facts
+		result.Facts = &facts
+	} else if b.Facts != nil {
+		result.Facts = result.Facts.Merge(b.Facts)
+	}
+	if result.SelfUpdate == nil && b.SelfUpdate != nil {
+		update := *b.SelfUpdate
+		result.SelfUpdate = &update
+	} else if b.SelfUpdate != nil {
+		result.SelfUpdate = result.SelfUpdate.Merge(b.SelfUpdate)
+	}
+	if result.ContainerRuntime == nil && b.ContainerRuntime != nil {
+		runtime := *b.ContainerRuntime
+		result.ContainerRuntime = &runtime
+	} else if b.ContainerRuntime != nil {
+		result.ContainerRuntime = result.ContainerRuntime.Merge(b.ContainerRuntime)
+	}
+
+	return &result
+}
+
+// ContainerRuntimeConfig contains the local settings of the runtime module
+type ContainerRuntimeConfig struct {
+
+	// DaemonConfigPath is the path to the Docker daemon configuration file
+	DaemonConfigPath string `hcl:"daemon_config_path,optional"`
+
+	// SocketPath is the path to the Unix socket of the runtime API
+	SocketPath string `hcl:"socket_path,optional"`
+
+	// RestartCommand is run when the daemon configuration changes
+	RestartCommand string `hcl:"restart_command,optional"`
+}
+
+// Merge merges two ContainerRuntimeConfig structs, returning the result
+func (c *ContainerRuntimeConfig) Merge(b *ContainerRuntimeConfig) *ContainerRuntimeConfig {
+
+	result := *c
+
+	if b.DaemonConfigPath != "" {
+		result.DaemonConfigPath = b.DaemonConfigPath
+	}
+	if b.SocketPath != "" {
+		result.SocketPath = b.SocketPath
+	}
+	if b.RestartCommand != "" {
+		result.RestartCommand = b.RestartCommand
+	}
+
+	return &result
+}
+
+// FactsConfig contains the settings of custom facts, which are
+// emitted by the executables of a directory as JSON or key=value pairs
+type FactsConfig struct {
+
+	// Dir is the directory containing the executables
+	Dir string `hcl:"dir,optional"`
+
+	// TTL is how long the output of an executable is reused, e.g. "5m"
+	TTL string `hcl:"ttl,optional"`
+
+	// Timeout is the maximum duration of a run, e.g. "10s"
+	Timeout string `hcl:"timeout,optional"`
+}
+
+// Merge merges two FactsConfig structs, returning the result
+func (c *FactsConfig) Merge(b *FactsConfig) *FactsConfig {
+
+	result := *c
+
+	if b.Dir != "" {
+		result.Dir = b.Dir
+	}
+	if b.TTL != "" {
+		result.TTL = b.TTL
+	}
+	if b.Timeout != "" {
+		result.Timeout = b.Timeout
+	}
 
 	return &result
 }
 
+// SelfUpdateConfig contains the settings of agent self-updates, which
+// are advertised by the API and verified against a pinned public key
+type SelfUpdateConfig struct {
+
+	// PublicKey is the base64-encoded ed25519 key updates are signed with
+	PublicKey string `hcl:"public_key,optional"`
+
+	// BinaryPath is the path of the agent binary, e.g. "/usr/local/bin/seashell"
+	BinaryPath string `hcl:"binary_path,optional"`
+
+	// ReadyTimeout is how long a new version has to become ready, e.g. "2m"
+	ReadyTimeout string `hcl:"ready_timeout,optional"`
+}
+
+// Merge merges two SelfUpdateConfig structs, returning the result
+func (c *SelfUpdateConfig) Merge(b *SelfUpdateConfig) *SelfUpdateConfig {
+
+	result := *c
+
+	if b.PublicKey != "" {
+		result.PublicKey = b.PublicKey
+	}
+	if b.BinaryPath != "" {
+		result.BinaryPath = b.BinaryPath
+	}
+	if b.ReadyTimeout != "" {
+		result.ReadyTimeout = b.ReadyTimeout
+	}
+
+	return &result
+}
+
+// HookConfig contains the configuration of a command run by the client
+// when a module configuration changes, when it starts, or periodically.
+type HookConfig struct {
+
+	// Name is the name of the hook
+	Name string `hcl:"name,label"`
+
+	// Trigger is one of "on_change", "on_start" or "periodic"
+	Trigger string `hcl:"trigger"`
+
+	// Module is the module whose changes trigger on_change hooks
+	Module string `hcl:"module,optional"`
+
+	// Command is run through the shell
+	Command string `hcl:"command"`
+
+	// Interval is the interval between runs of periodic hooks, e.g. "5m"
+	Interval string `hcl:"interval,optional"`
+
+	// Timeout is the maximum duration of a run, e.g. "30s"
+	Timeout string `hcl:"timeout,optional"`
+
+	// Env contains additional environment variables
+	Env map[string]string `hcl:"env,optional"`
+}
+
+// DragoConfig contains the local settings of the drago module
+type DragoConfig struct {
+
+	// WireguardPath is the path to the WireGuard implementation used by Drago
+	WireguardPath string `hcl:"wireguard_path,optional"`
+
+	// WireguardToolPath is the path to the wg tool
+	WireguardToolPath string `hcl:"wireguard_tool_path,optional"`
+
+	// InterfacePrefix is the prefix of the names of the interfaces managed by Drago
+	InterfacePrefix string `hcl:"interface_prefix,optional"`
+
+	// ListenPort is the port on which Drago interfaces listen
+	ListenPort int `hcl:"listen_port,optional"`
+}
+
+// Merge merges two DragoConfig structs, returning the result
+func (c *DragoConfig) Merge(b *DragoConfig) *DragoConfig {
+
+	result := *c
+
+	if b.WireguardPath != "" {
+		result.WireguardPath = b.WireguardPath
+	}
+	if b.WireguardToolPath != "" {
+		result.WireguardToolPath = b.WireguardToolPath
+	}
+	if b.InterfacePrefix != "" {
+		result.InterfacePrefix = b.InterfacePrefix
+	}
+	if b.ListenPort != 0 {
+		result.ListenPort = b.ListenPort
+	}
+
+	return &result
+}
+
+// ValidatorConfig contains the configuration of a validator that is run
+// against a module configuration after it is rendered and before it
+// replaces the live one.
+type ValidatorConfig struct {
+
+	// Module is the name of the module whose output is validated
+	Module string `hcl:"module,label"`
+
+	// Command is the validator command, e.g. "consul validate {file}"
+	Command string `hcl:"command,optional"`
+
+	// HCL enables in-process parsing of the rendered file as HCL
+	HCL bool `hcl:"hcl,optional"`
+
+	// Timeout is the maximum duration of the validator command, e.g. "10s"
+	Timeout string `hcl:"timeout,optional"`
+}
+
 // DefaultConfig returns a Config struct populated with sane defaults
 func DefaultConfig() *Config {
 	return &Config{
@@ -158,6 +460,7 @@ func DefaultConfig() *Config {
 		APIAddr:  defaultAPIAddr,
 		LogLevel: "DEBUG",
 		DataDir:  defaultDataDir,
+		HTTPAddr: defaultHTTPAddr,
 		Client: &ClientConfig{
 			APIAddr:             defaultAPIAddr,
 			OutputDir:           path.Join(defaultDataDir, "output"),
@@ -192,7 +495,7 @@ func (c *Config) LoadFromFile(path string) (*Config, error) {
 
 	config := &Config{}
 
-	err = hclsimple.DecodeFile(path, nil, config)
+	err = DecodeConfigFile(path, config)
 	if err != nil {
 		return nil, err
 	}
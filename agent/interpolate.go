@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// deferredVariables are the roots of the references interpolated by the
+// client rather than when decoding the configuration, e.g. ${fact.hostname}
+var deferredVariables = []string{"fact", "meta"}
+
+// DecodeConfigFile decodes an HCL or JSON configuration file into config.
+// In HCL files, references to device facts and client metadata such as
+// "${fact.hostname}" are kept verbatim, so that they are interpolated by
+// the client. In JSON files, they must be escaped as "$${fact.hostname}".
+func DecodeConfigFile(path string, config *Config) error {
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var ctx *hcl.EvalContext
+
+	if filepath.Ext(path) == ".hcl" {
+		file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return diags
+		}
+		if ctx, err = deferredContext(file.Body.(*hclsyntax.Body)); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	return hclsimple.Decode(path, src, ctx, config)
+}
+
+// deferredContext returns an evaluation context in which every reference
+// to a deferred variable within body evaluates to the reference itself.
+func deferredContext(body *hclsyntax.Body) (*hcl.EvalContext, error) {
+
+	roots := map[string]map[string]interface{}{}
+	for _, name := range deferredVariables {
+		roots[name] = map[string]interface{}{}
+	}
+
+	var err error
+
+	hclsyntax.VisitAll(body, func(n hclsyntax.Node) hcl.Diagnostics {
+
+		expr, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok || err != nil {
+			return nil
+		}
+
+		root, ok := roots[expr.Traversal.RootName()]
+		if !ok {
+			return nil
+		}
+
+		path := []string{}
+		for _, step := range expr.Traversal[1:] {
+			attr, ok := step.(hcl.TraverseAttr)
+			if !ok {
+				err = fmt.Errorf("unsupported reference at %s", expr.SrcRange)
+				return nil
+			}
+			path = append(path, attr.Name)
+		}
+
+		if len(path) == 0 {
+			err = fmt.Errorf("incomplete reference to %s at %s", expr.Traversal.RootName(), expr.SrcRange)
+			return nil
+		}
+
+		ref := "${" + expr.Traversal.RootName() + "." + strings.Join(path, ".") + "}"
+		if !insertReference(root, path, ref) {
+			err = fmt.Errorf("conflicting reference %s at %s", ref, expr.SrcRange)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{}}
+	for name, root := range roots {
+		ctx.Variables[name] = referenceValue(root)
+	}
+
+	return ctx, nil
+}
+
+// insertReference inserts ref at path within a tree of references,
+// returning false if path conflicts with another reference, e.g.
+// ${fact.modem} and ${fact.modem.imei}
+func insertReference(tree map[string]interface{}, path []string, ref string) bool {
+
+	existing, ok := tree[path[0]]
+
+	if len(path) == 1 {
+		if ok {
+			_, isLeaf := existing.(string)
+			return isLeaf
+		}
+		tree[path[0]] = ref
+		return true
+	}
+
+	if !ok {
+		existing = map[string]interface{}{}
+		tree[path[0]] = existing
+	}
+
+	subtree, ok := existing.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	return insertReference(subtree, path[1:], ref)
+}
+
+func referenceValue(v interface{}) cty.Value {
+
+	if s, ok := v.(string); ok {
+		return cty.StringVal(s)
+	}
+
+	attrs := map[string]cty.Value{}
+	for k, v := range v.(map[string]interface{}) {
+		attrs[k] = referenceValue(v)
+	}
+
+	return cty.ObjectVal(attrs)
+}
@@ -177,8 +177,35 @@ func (c *Client) do(req *http.Request, receiver interface{}) error {
 	}
 
 	if receiver != nil {
-		return json.NewDecoder(res.Body).Decode(receiver)
+		if err := json.NewDecoder(res.Body).Decode(receiver); err != nil {
+			return err
+		}
+		if r, ok := receiver.(metaSetter); ok {
+			r.SetMeta(responseMeta(res))
+		}
 	}
 
 	return nil
 }
+
+// metaSetter is implemented by responses which
+// keep metadata about the HTTP response
+type metaSetter interface {
+	SetMeta(map[string]string)
+}
+
+// responseMeta extracts metadata from an HTTP response
+func responseMeta(res *http.Response) map[string]string {
+
+	meta := map[string]string{
+		"Status": res.Status,
+	}
+
+	for _, h := range []string{"Date", "ETag", "Last-Modified", "X-Request-Id"} {
+		if v := res.Header.Get(h); v != "" {
+			meta[h] = v
+		}
+	}
+
+	return meta
+}
@@ -63,3 +63,25 @@ func (d *Devices) SyncDevice(ctx context.Context, req *structs.DeviceSyncRequest
 
 	return &resp, nil
 }
+
+// Heartbeat :
+func (d *Devices) Heartbeat(ctx context.Context, req *structs.DeviceHeartbeatRequest) (*structs.DeviceHeartbeatResponse, error) {
+
+	var resp structs.DeviceHeartbeatResponse
+
+	c := d.client.WithHeaders(map[string]string{
+		"X-Organization-ID":  req.OrganizationID,
+		"X-Project-ID":       req.ProjectID,
+		"X-Device-Batch-ID":  req.BatchID,
+		"X-Device-ID":        req.DeviceID,
+		"Authorization":      fmt.Sprintf("Bearer %s", req.AuthToken),
+		"X-Device-Remote-ID": req.DeviceRemoteID,
+	})
+
+	err := c.post(devicesPath+"/heartbeat", req.Heartbeat, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
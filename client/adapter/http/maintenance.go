@@ -0,0 +1,60 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+)
+
+// MaintenanceHandler is used to inspect the maintenance windows, and
+// to apply a configuration held until the next one opens right away
+type MaintenanceHandler struct {
+	client *client.Client
+}
+
+// NewMaintenanceHandler :
+func NewMaintenanceHandler(client *client.Client) *MaintenanceHandler {
+	return &MaintenanceHandler{
+		client: client,
+	}
+}
+
+// Handle :
+func (h *MaintenanceHandler) Handle(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	action := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/maintenance"), "/")
+
+	switch {
+	case action == "" && req.Method == "GET":
+		return h.handleStatus(rw, req)
+	case action == "apply" && req.Method == "POST":
+		return h.handleApply(rw, req)
+	case action == "" || action == "apply":
+		return nil, NewCodedError(405, ErrMethodNotAllowed)
+	default:
+		return nil, NewCodedError(404, ErrNotFound)
+	}
+}
+
+func (h *MaintenanceHandler) handleStatus(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	status := h.client.MaintenanceStatus()
+	if status == nil {
+		return nil, NewCodedError(404, ErrNotFound, "no maintenance windows configured")
+	}
+
+	return status, nil
+}
+
+func (h *MaintenanceHandler) handleApply(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	if err := h.client.ApplyPendingConfiguration(); err != nil {
+		if isInvalidInputError(err) {
+			return nil, NewCodedError(400, ErrBadRequest, err)
+		}
+		return nil, parseError(err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,33 @@
+package http
+
+import (
+	"net/http"
+
+	client "github.com/seashell/agent/client"
+)
+
+// MetricsHandler exposes the counters maintained by the client
+type MetricsHandler struct {
+	client *client.Client
+}
+
+// NewMetricsHandler :
+func NewMetricsHandler(client *client.Client) *MetricsHandler {
+	return &MetricsHandler{
+		client: client,
+	}
+}
+
+// Handle :
+func (h *MetricsHandler) Handle(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return h.handleGet(rw, req)
+	default:
+		return nil, NewCodedError(405, ErrMethodNotAllowed)
+	}
+}
+
+func (h *MetricsHandler) handleGet(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return h.client.Metrics(), nil
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TokenHeader is the header in which requests can carry their token,
+	// as an alternative to a bearer token in the Authorization header
+	TokenHeader = "X-Seashell-Token"
+)
+
+// Token : rejects requests which do not carry the given token
+func Token(token string) func(http.HandlerFunc) http.HandlerFunc {
+	m := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, req *http.Request) {
+
+			got := req.Header.Get(TokenHeader)
+			if got == "" {
+				got = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			}
+
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusUnauthorized)
+				rw.Write([]byte(`{"Message":"Unauthorized"}`))
+				return
+			}
+
+			next(rw, req)
+		}
+	}
+	return m
+}
@@ -8,7 +8,7 @@ import (
 
 	"time"
 
-	log "github.com/seashell/drago/pkg/log"
+	log "github.com/seashell/agent/pkg/log"
 )
 
 // LoggingResponseWriter :
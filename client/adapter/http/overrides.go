@@ -0,0 +1,79 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// OverridesHandler is used to manage the local configuration override
+type OverridesHandler struct {
+	client *client.Client
+}
+
+// NewOverridesHandler :
+func NewOverridesHandler(client *client.Client) *OverridesHandler {
+	return &OverridesHandler{
+		client: client,
+	}
+}
+
+// Handle :
+func (h *OverridesHandler) Handle(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+	switch req.Method {
+	case "GET":
+		return h.handleGet(rw, req)
+	case "PUT":
+		return h.handlePut(rw, req)
+	case "DELETE":
+		return h.handleDelete(rw, req)
+	default:
+		return nil, NewCodedError(405, ErrMethodNotAllowed)
+	}
+}
+
+func (h *OverridesHandler) handleGet(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	override, err := h.client.Override()
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	if override == nil {
+		return nil, NewCodedError(404, ErrNotFound)
+	}
+
+	return override, nil
+}
+
+func (h *OverridesHandler) handlePut(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	override := &structs.ConfigurationOverride{}
+	if err := parseBody(req.Body, override); err != nil {
+		return nil, NewCodedError(400, ErrBadRequest, err)
+	}
+
+	if err := h.client.SetOverride(override); err != nil {
+		if isInvalidInputError(err) {
+			return nil, NewCodedError(400, ErrBadRequest, err)
+		}
+		return nil, parseError(err)
+	}
+
+	return override, nil
+}
+
+func (h *OverridesHandler) handleDelete(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	if err := h.client.DeleteOverride(); err != nil {
+		return nil, parseError(err)
+	}
+
+	return nil, nil
+}
+
+func isInvalidInputError(err error) bool {
+	return strings.HasPrefix(err.Error(), structs.ErrInvalidInput.Error())
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// StateHandler is used to inspect, export, import and reset the client
+// state while the agent is running, since it holds the state DB lock
+type StateHandler struct {
+	client *client.Client
+}
+
+// NewStateHandler :
+func NewStateHandler(client *client.Client) *StateHandler {
+	return &StateHandler{
+		client: client,
+	}
+}
+
+// Handle :
+func (h *StateHandler) Handle(rw http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	action := strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/state"), "/")
+
+	switch {
+	case action == "" && req.Method == "GET":
+		return h.handleShow(rw, req)
+	case action == "export" && req.Method == "GET":
+		return h.handleExport(rw, req)
+	case action == "import" && req.Method == "PUT":
+		return h.handleImport(rw, req)
+	case action == "reset" && req.Method == "POST":
+		return h.handleReset(rw, req)
+	case action == "" || action == "export" || action == "import" || action == "reset":
+		return nil, NewCodedError(405, ErrMethodNotAllowed)
+	default:
+		return nil, NewCodedError(404, ErrNotFound)
+	}
+}
+
+func (h *StateHandler) handleShow(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	configs, err := h.client.StoredConfigurations(req.URL.Query().Get("module"))
+	if err != nil {
+		if isInvalidInputError(err) {
+			return nil, NewCodedError(400, ErrBadRequest, err)
+		}
+		return nil, parseError(err)
+	}
+
+	return configs, nil
+}
+
+func (h *StateHandler) handleExport(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	e, err := h.client.ExportState()
+	if err != nil {
+		return nil, parseError(err)
+	}
+
+	return e, nil
+}
+
+func (h *StateHandler) handleImport(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	e := &structs.StateExport{}
+	if err := parseBody(req.Body, e); err != nil {
+		return nil, NewCodedError(400, ErrBadRequest, err)
+	}
+
+	if err := h.client.ImportState(e); err != nil {
+		if isInvalidInputError(err) {
+			return nil, NewCodedError(400, ErrBadRequest, err)
+		}
+		return nil, parseError(err)
+	}
+
+	return nil, nil
+}
+
+func (h *StateHandler) handleReset(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	if err := h.client.ResetState(req.URL.Query().Get("module")); err != nil {
+		if isInvalidInputError(err) {
+			return nil, NewCodedError(400, ErrBadRequest, err)
+		}
+		return nil, parseError(err)
+	}
+
+	return nil, nil
+}
@@ -3,19 +3,18 @@ package http
 import (
 	"net/http"
 
-	"github.com/seashell/agent/pkg/rpc"
-	"github.com/seashell/agent/seashell/structs"
+	client "github.com/seashell/agent/client"
 )
 
-// StatusHandler is used to check on server status
+// StatusHandler is used to check on client status
 type StatusHandler struct {
-	rpcClient *rpc.Client
+	client *client.Client
 }
 
 // NewStatusHandler :
-func NewStatusHandler(rpcClient *rpc.Client) *StatusHandler {
+func NewStatusHandler(client *client.Client) *StatusHandler {
 	return &StatusHandler{
-		rpcClient: rpcClient,
+		client: client,
 	}
 }
 
@@ -30,13 +29,5 @@ func (h *StatusHandler) Handle(rw http.ResponseWriter, req *http.Request) (inter
 }
 
 func (h *StatusHandler) handleGet(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
-
-	var args structs.GenericRequest
-
-	var out structs.GenericResponse
-	if err := h.rpcClient.Call("Status.Ping", &args, &out); err != nil {
-		return nil, err
-	}
-
-	return out, nil
+	return h.client.Status(), nil
 }
@@ -3,18 +3,22 @@ package client
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	api "github.com/seashell/agent/api"
 	state "github.com/seashell/agent/client/state"
 	boltdb "github.com/seashell/agent/client/state/boltdb"
+	inmem "github.com/seashell/agent/client/state/inmem"
+	diff "github.com/seashell/agent/pkg/diff"
 	log "github.com/seashell/agent/pkg/log"
 	structs "github.com/seashell/agent/seashell/structs"
 )
@@ -34,6 +38,16 @@ var (
 	defaultReconciliationInterval      = 2 * time.Second
 	defaultFirstHeartbeatDelay         = 1 * time.Second
 	defaultHeartbeatInterval           = 1 * time.Second
+	defaultModuleRetryInterval         = 5 * time.Second
+	defaultModuleMaxRetryInterval      = 5 * time.Minute
+	defaultModuleRetryCheckInterval    = 1 * time.Second
+	defaultAgentStateLockTimeout       = 10 * time.Second
+)
+
+const (
+	// moduleFileMode is the mode of the files rendered by modules, which
+	// contain secrets such as gossip keys, ACL tokens and private keys
+	moduleFileMode = 0600
 )
 
 // Client is the Seashell client
@@ -46,6 +60,25 @@ type Client struct {
 
 	state state.Repository
 
+	events *eventLog
+
+	hooks *hookRunner
+
+	runtime *runtimeState
+
+	modules *moduleStatuses
+
+	// desired and remote are the latest configurations reconciled,
+	// which are reconciled again when retrying failed modules
+	desired *structs.Configuration
+	remote  *structs.Configuration
+
+	metrics *metrics
+
+	facts *factsCache
+
+	update *updateState
+
 	device     *structs.Device
 	deviceLock sync.Mutex
 
@@ -60,19 +93,21 @@ func New(config *Config) (*Client, error) {
 
 	rand.Seed(time.Now().Unix())
 
-	config = DefaultConfig().Merge(config)
-
-	c := &Client{
-		config:     config,
-		logger:     config.Logger.WithName("client"),
-		shutdownCh: make(chan struct{}),
-	}
+	c := newClient(config)
 
 	err := c.setupState()
 	if err != nil {
 		return nil, fmt.Errorf("error setting up client state: %v", err)
 	}
 
+	c.loadModuleStatuses()
+
+	// A failed update is rolled back before anything else, in case
+	// the new version does not manage to obtain a token, for instance
+	if err := c.setupUpdate(); err != nil {
+		c.logger.Errorf("error resuming agent update: %v", err)
+	}
+
 	err = c.setupOutputDir()
 	if err != nil {
 		return nil, fmt.Errorf("error setting up output dir: %v", err)
@@ -100,6 +135,26 @@ func New(config *Config) (*Client, error) {
 	return c, nil
 }
 
+// newClient creates a client from the configuration, without setting
+// up any of its dependencies nor starting its reconciliation loop.
+func newClient(config *Config) *Client {
+
+	config = DefaultConfig().Merge(config)
+
+	return &Client{
+		config:     config,
+		logger:     config.Logger.WithName("client"),
+		events:     newEventLog(defaultEventLogSize),
+		hooks:      newHookRunner(),
+		runtime:    &runtimeState{},
+		modules:    newModuleStatuses(),
+		metrics:    newMetrics(),
+		facts:      &factsCache{},
+		update:     newUpdateState(),
+		shutdownCh: make(chan struct{}),
+	}
+}
+
 // Device returns the device managed by this client
 func (c *Client) Device() *structs.Device {
 	return c.device
@@ -115,6 +170,34 @@ func (c *Client) DeviceSecret() string {
 	return c.device.Secret
 }
 
+// Status returns the current status of the client
+func (c *Client) Status() *structs.ClientStatus {
+
+	c.deviceLock.Lock()
+	status := &structs.ClientStatus{
+		DeviceID: c.device.ID,
+		Status:   c.device.Status,
+	}
+	c.deviceLock.Unlock()
+
+	if ifaces, err := c.DragoInterfaces(); err != nil {
+		c.logger.Debugf("could not read drago interfaces: %v", err)
+	} else {
+		status.Interfaces = ifaces
+	}
+
+	status.Modules = c.ModuleStatuses()
+	status.Facts = c.Facts()
+	status.Update = c.AgentUpdateStatus()
+	status.Maintenance = c.MaintenanceStatus()
+	status.Hooks = c.HookStatuses()
+	status.Runtime = c.ContainerRuntimeStatus()
+	status.Overrides = c.overrides()
+	status.Events = c.Events()
+
+	return status
+}
+
 func (c *Client) setupDevice() error {
 
 	if c.device == nil {
@@ -168,7 +251,39 @@ func (c *Client) setupState() error {
 
 	c.logger.Infof("using state directory %s", c.config.StateDir)
 
-	repo := boltdb.NewStateRepository(path.Join(c.config.StateDir, "client.state"), c.logger)
+	if c.config.StateRepository != nil {
+		c.state = c.config.StateRepository
+		return nil
+	}
+
+	switch c.config.StateBackend {
+	case StateBackendBoltDB:
+	case StateBackendInmem:
+		c.logger.Warnf("keeping client state in memory, it will be lost once the client stops")
+		c.state = inmem.NewStateRepository()
+		return nil
+	default:
+		return fmt.Errorf("unknown state backend %q", c.config.StateBackend)
+	}
+
+	file := path.Join(c.config.StateDir, "client.state")
+
+	repo, err := boltdb.OpenStateRepository(file, defaultAgentStateLockTimeout, c.logger)
+	if errors.Is(err, boltdb.ErrCorrupted) {
+		repo, err = c.recoverState(file, err)
+	}
+	if errors.Is(err, boltdb.ErrLocked) {
+		return fmt.Errorf("client state %s is locked, is another agent running? (%v)", file, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open client state %s: %v", file, err)
+	}
+
+	// The state is backed up once it is known to be valid, so
+	// that it can be restored in case it is corrupted later on
+	if err := repo.Backup(); err != nil {
+		c.logger.Warnf("could not back up client state: %v", err)
+	}
 
 	c.state = repo
 
@@ -214,8 +329,15 @@ func (c *Client) run() {
 
 	c.logger.Debugf("running client")
 
-	configurationUpdateCh := make(chan *structs.Configuration)
+	c.runLocalStartHooks()
+
+	configurationUpdateCh := make(chan *structs.DeviceSyncResponse)
 	go c.watchConfiguration(configurationUpdateCh)
+	go c.heartbeat()
+	go c.runPeriodicHooks()
+
+	retryTicker := time.NewTicker(defaultModuleRetryCheckInterval)
+	defer retryTicker.Stop()
 
 	for {
 		select {
@@ -229,41 +351,85 @@ func (c *Client) run() {
 			c.reconcileConfiguration(desired)
 
 			c.shutdownLock.Unlock()
+
+			c.runQueuedHooks()
+		case <-retryTicker.C:
+			c.shutdownLock.Lock()
+			if c.shutdown {
+				c.shutdownLock.Unlock()
+				return
+			}
+
+			c.applyPendingConfigurationInWindow()
+			c.retryFailedModules()
+
+			c.shutdownLock.Unlock()
+
+			c.runQueuedHooks()
 		case <-c.shutdownCh:
 			return
 		}
 	}
 }
 
-func (c *Client) reconcileConfiguration(desired *structs.Configuration) {
+func (c *Client) reconcileConfiguration(resp *structs.DeviceSyncResponse) {
+
+	if !c.holdConfiguration(resp) {
+		if err := c.applyConfiguration(resp); err != nil {
+			c.logger.Errorf("error persisting client state: %v", err)
+			return
+		}
+	}
+
+	c.markReady()
+	c.checkAgentUpdate(resp.AgentUpdate)
+}
+
+// applyConfiguration reconciles all modules with the configuration
+// received from the API, which is no longer pending once applied
+func (c *Client) applyConfiguration(resp *structs.DeviceSyncResponse) error {
 
 	c.logger.Debugf("reconciliation started...")
 
-	if err := c.reconcileDragoConfiguration(desired); err != nil {
-		c.logger.Warnf("error reconciling drago configuration : %v", err)
-	}
+	remote := resp.Configuration
 
-	if err := c.reconcileNomadConfiguration(desired); err != nil {
-		c.logger.Warnf("error reconciling nomad configuration : %v", err)
-	}
+	desired := c.overriddenConfiguration(remote)
 
-	if err := c.reconcileConsulConfiguration(desired); err != nil {
-		c.logger.Warnf("error reconciling consul configuration : %v", err)
-	}
+	// Hooks are only ever taken from the configuration received from the
+	// API, since overrides can be set by anyone with access to the local API
+	c.updateRemoteHooks(remote)
+
+	// The remote configuration, as well as the state and history of all
+	// modules, are persisted in a single transaction per reconciliation
+	return c.updateState(func(tx state.Transaction) error {
+		c.recordRemoteConfiguration(tx, resp)
+		c.reconcileModules(tx, desired, remote)
+		return tx.DeletePendingConfiguration()
+	})
+}
 
+func (c *Client) desiredDragoConfiguration(config *structs.Configuration) *structs.DragoConfiguration {
+	return &structs.DragoConfiguration{
+		Name:            c.config.DeviceRemoteID,
+		DataDir:         path.Join(c.config.StateDir, "drago"),
+		Servers:         config.DragoIPAddresses,
+		Secret:          config.DragoSecret,
+		WireguardPath:   c.config.Drago.WireguardPath,
+		InterfacePrefix: c.config.Drago.InterfacePrefix,
+		ListenPort:      c.config.Drago.ListenPort,
+		Meta:            config.Labels,
+	}
 }
 
-func (c *Client) reconcileDragoConfiguration(config *structs.Configuration) error {
+func (c *Client) reconcileDragoConfiguration(tx state.Transaction, config, remote *structs.Configuration) error {
+
+	desired := c.desiredDragoConfiguration(config)
 
-	desired := &structs.DragoConfiguration{
-		Name:    c.config.DeviceRemoteID,
-		DataDir: path.Join(c.config.StateDir, "drago"),
-		Servers: config.DragoIPAddresses,
-		Secret:  config.DragoSecret,
-		Meta:    config.Labels,
+	if pinned := (&structs.DragoConfiguration{}); c.pinnedConfiguration(tx, "drago", remote, pinned) {
+		desired = pinned
 	}
 
-	current, err := c.state.DragoConfiguration()
+	current, err := tx.DragoConfiguration()
 	if err != nil {
 		c.logger.Errorf("could not read drago configuration: %v", err)
 	}
@@ -272,34 +438,68 @@ func (c *Client) reconcileDragoConfiguration(config *structs.Configuration) erro
 
 		c.logger.Debugf("changes detected in drago configuration. rendering template and persisting to repository...")
 
-		if err := renderTemplateToFile(dragoTemplateString, path.Join(c.config.OutputDir, "drago.hcl"), desired); err != nil {
+		if err := c.renderModuleFile(tx, "drago", dragoTemplateString, desired, nil); err != nil {
 			return err
 		}
 
 		// We only persist configurations that were successfully rendered so as
 		// to ensure the state in the DB is synced with the configuration files.
-		if err := c.state.SetDragoConfiguration(desired); err != nil {
+		if err := tx.SetDragoConfiguration(desired); err != nil {
 			return err
 		}
 
+		c.recordConfigurationChange(tx, "drago", current, desired)
+		c.recordConfigurationVersion(tx, "drago", desired, nil)
+		c.moduleChanged("drago")
+
 		return nil
 	}
 
-	c.logger.Debugf("no changes detected in drago configuration. skipping reconciliation...")
+	c.logger.Debugf("no changes detected in drago configuration. checking for drift...")
 
-	return nil
+	return c.checkRenderedFileDrift(tx, "drago", dragoTemplateString, desired, nil)
 }
 
-func (c *Client) reconcileNomadConfiguration(config *structs.Configuration) error {
+func (c *Client) desiredNomadConfiguration(config *structs.Configuration) *structs.NomadConfiguration {
 
 	desired := &structs.NomadConfiguration{
 		Name:      c.config.DeviceRemoteID,
 		DataDir:   path.Join(c.config.StateDir, "nomad"),
-		RetryJoin: "", // TODO: get from Drago and, in the future, replace using go-connect
+		RetryJoin: c.retryJoin("nomad", config.NomadServers, config.NomadRetryJoin),
 		Meta:      config.Labels,
+
+		DragoInterfacePrefix: c.config.Drago.InterfacePrefix,
+	}
+
+	if config.Nomad != nil {
+		desired.NomadSettings = *config.Nomad
+	}
+
+	if desired.Region == "" {
+		desired.Region = defaultNomadRegion
+	}
+	if desired.Datacenter == "" {
+		desired.Datacenter = defaultNomadDatacenter
+	}
+	if len(desired.HostNetworks) == 0 {
+		desired.HostNetworks = defaultNomadHostNetworks(desired.DragoInterfacePrefix)
+	}
+	if len(desired.Plugins) == 0 {
+		desired.Plugins = defaultNomadPlugins()
+	}
+
+	return desired
+}
+
+func (c *Client) reconcileNomadConfiguration(tx state.Transaction, config, remote *structs.Configuration) error {
+
+	desired := c.desiredNomadConfiguration(config)
+
+	if pinned := (&structs.NomadConfiguration{}); c.pinnedConfiguration(tx, "nomad", remote, pinned) {
+		desired = pinned
 	}
 
-	current, err := c.state.NomadConfiguration()
+	current, err := tx.NomadConfiguration()
 	if err != nil {
 		c.logger.Errorf("could not read nomad configuration: %v", err)
 	}
@@ -308,34 +508,89 @@ func (c *Client) reconcileNomadConfiguration(config *structs.Configuration) erro
 
 		c.logger.Debugf("changes detected in nomad configuration. rendering template and persisting to repository...")
 
-		if err := renderTemplateToFile(nomadTemplateString, path.Join(c.config.OutputDir, "nomad.hcl"), desired); err != nil {
+		if err := c.renderModuleFile(tx, "nomad", nomadTemplateString, desired, nil); err != nil {
 			return err
 		}
 
 		// We only persist configurations that were successfully rendered so as
 		// to ensure the state in the DB is synced with the configuration files.
-		if err := c.state.SetNomadConfiguration(desired); err != nil {
+		if err := tx.SetNomadConfiguration(desired); err != nil {
 			return err
 		}
 
+		c.recordConfigurationChange(tx, "nomad", current, desired)
+		c.recordConfigurationVersion(tx, "nomad", desired, nil)
+		c.moduleChanged("nomad")
+
 		return nil
 	}
 
-	c.logger.Debugf("no changes detected in nomad configuration. skipping reconciliation...")
+	c.logger.Debugf("no changes detected in nomad configuration. checking for drift...")
 
-	return nil
+	return c.checkRenderedFileDrift(tx, "nomad", nomadTemplateString, desired, nil)
 }
 
-func (c *Client) reconcileConsulConfiguration(config *structs.Configuration) error {
+func (c *Client) desiredConsulConfiguration(config *structs.Configuration) *structs.ConsulConfiguration {
 
 	desired := &structs.ConsulConfiguration{
 		Name:      c.config.DeviceRemoteID,
 		DataDir:   path.Join(c.config.StateDir, "consul"),
-		RetryJoin: "", // TODO: get from Drago and, in the future, replace using go-connect
+		RetryJoin: c.retryJoin("consul", config.ConsulServers, config.ConsulRetryJoin),
 		Meta:      config.Labels,
+
+		DragoInterfacePrefix: c.config.Drago.InterfacePrefix,
+	}
+
+	if config.Consul != nil {
+		desired.ConsulSettings = *config.Consul
+	}
+
+	if desired.Datacenter == "" {
+		desired.Datacenter = defaultConsulDatacenter
+	}
+
+	if tls := desired.TLS; tls != nil {
+		ca, cert, key := c.consulTLSFiles()
+		if tls.CA != "" {
+			desired.CAFile = ca
+		}
+		if tls.Cert != "" {
+			desired.CertFile = cert
+		}
+		if tls.Key != "" {
+			desired.KeyFile = key
+		}
+	}
+
+	return desired
+}
+
+// retryJoin returns the addresses and cloud auto-join strings a module
+// should use for joining its cluster. If none is specified in the remote
+// configuration, the addresses of the Drago peers are used instead.
+func (c *Client) retryJoin(module string, servers []string, autoJoin []string) []string {
+
+	out := []string{}
+	out = append(out, servers...)
+	out = append(out, autoJoin...)
+
+	if len(out) == 0 {
+		out = c.dragoPeerAddresses()
+		c.logger.Debugf("no %s servers specified, falling back to drago peers: %v", module, out)
+	}
+
+	return out
+}
+
+func (c *Client) reconcileConsulConfiguration(tx state.Transaction, config, remote *structs.Configuration) error {
+
+	desired := c.desiredConsulConfiguration(config)
+
+	if pinned := (&structs.ConsulConfiguration{}); c.pinnedConfiguration(tx, "consul", remote, pinned) {
+		desired = pinned
 	}
 
-	current, err := c.state.ConsulConfiguration()
+	current, err := tx.ConsulConfiguration()
 	if err != nil {
 		c.logger.Errorf("could not read consul configuration: %v", err)
 	}
@@ -344,44 +599,115 @@ func (c *Client) reconcileConsulConfiguration(config *structs.Configuration) err
 
 		c.logger.Debugf("changes detected in consul configuration. rendering template and persisting to repository...")
 
-		if err := renderTemplateToFile(consulTemplateString, path.Join(c.config.OutputDir, "consul.hcl"), desired); err != nil {
+		// Certificate material is only moved into place along with the
+		// configuration file, once the latter passed validation.
+		if err := c.renderModuleFile(tx, "consul", consulTemplateString, desired, c.consulTLSFileContents(desired)); err != nil {
 			return err
 		}
 
-		if err := c.state.SetConsulConfiguration(desired); err != nil {
+		if err := tx.SetConsulConfiguration(desired); err != nil {
 			return err
 		}
 
+		c.recordConfigurationChange(tx, "consul", current, desired)
+		c.recordConfigurationVersion(tx, "consul", desired, nil)
+		c.moduleChanged("consul")
+
 		return nil
 	}
 
-	c.logger.Debugf("no changes detected in consul configuration. skipping reconciliation...")
+	c.logger.Debugf("no changes detected in consul configuration. checking for drift...")
 
-	return nil
+	return c.checkRenderedFileDrift(tx, "consul", consulTemplateString, desired, c.consulTLSFileContents(desired))
 }
 
-func (c *Client) watchConfiguration(ch chan *structs.Configuration) {
+// recordConfigurationChange logs the field-level changes between the
+// current and desired configurations of a module, also storing them
+// in the client state so as to keep a history of changes.
+func (c *Client) recordConfigurationChange(tx state.Transaction, module string, current, desired interface{}) {
 
-	c.logger.Debugf("watching configuration")
+	changes := diff.Objects(current, desired)
+	if len(changes) == 0 {
+		return
+	}
 
-	for {
+	desc := make([]string, 0, len(changes))
+	for _, change := range changes {
+		desc = append(desc, change.String())
+	}
+
+	c.emitEvent(structs.EventTypeInfo, module, "configuration changed: %s", strings.Join(desc, "; "))
+
+	record := &structs.ConfigurationChange{
+		Module:    module,
+		Changes:   changes,
+		Timestamp: time.Now(),
+	}
+
+	if err := tx.AddConfigurationChange(record); err != nil {
+		c.logger.Warnf("could not record %s configuration change: %v", module, err)
+	}
+}
+
+// renderModuleFile renders the template of a module to a temporary file
+// and, once validated, atomically replaces the live configuration file
+// with it. Files referenced by the configuration, keyed by path, are
+// staged along with it, and are only moved into place, or removed in
+// case their content is empty, once the configuration is valid.
+func (c *Client) renderModuleFile(tx state.Transaction, module string, tmpl string, data interface{}, files map[string]string) error {
+
+	out := path.Join(c.config.OutputDir, module+".hcl")
+
+	content, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return err
+	}
+
+	staged, err := stageFiles(files, moduleFileMode)
+	if err != nil {
+		return err
+	}
+	defer discardStagedFiles(staged)
+
+	tmp, err := writeTempFile(out, content, moduleFileMode)
+	if err != nil {
+		return err
+	}
+
+	if err := c.validateRenderedFile(module, tmp); err != nil {
+		os.Remove(tmp)
+		c.emitEvent(structs.EventTypeWarning, module, "rendered configuration rejected by validator: %v", err)
+		return fmt.Errorf("rendered configuration is invalid: %v", err)
+	}
+
+	if err := commitStagedFiles(staged); err != nil {
+		os.Remove(tmp)
+		return err
+	}
 
-		var err error
-		var resp *structs.DeviceSyncResponse
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing configuration file: %v", err)
+	}
 
-		req := &structs.DeviceSyncRequest{
-			OrganizationID: c.config.OrganizationID,
-			ProjectID:      c.config.ProjectID,
-			BatchID:        c.config.DeviceBatchID,
-			DeviceID:       c.config.DeviceID,
-			DeviceRemoteID: c.config.DeviceRemoteID,
+	// Keep track of the checksums of the rendered files,
+	// so that drift can be detected in subsequent reconciliations
+	for _, f := range staged {
+		if err := tx.SetFileChecksum(f.path, f.checksum()); err != nil {
+			return err
 		}
+	}
+
+	return tx.SetFileChecksum(out, checksum(content))
+}
 
-		req.QueryOptions.AuthToken = c.Device().Token
+func (c *Client) watchConfiguration(ch chan *structs.DeviceSyncResponse) {
 
-		ctx := context.TODO()
+	c.logger.Debugf("watching configuration")
+
+	for {
 
-		if resp, err = c.api.Devices().SyncDevice(ctx, req); err != nil {
+		if resp, err := c.syncConfiguration(); err != nil {
 			c.logger.Debugf("error syncing device: %v", err)
 
 			c.tryToGetTokenUntilSuccessful()
@@ -394,7 +720,7 @@ func (c *Client) watchConfiguration(ch chan *structs.Configuration) {
 			}
 
 		} else {
-			ch <- resp.Configuration
+			ch <- resp
 		}
 
 		retryCh := time.After(randomDuration(c.config.ReconcileInterval, 1*time.Second))
@@ -406,6 +732,33 @@ func (c *Client) watchConfiguration(ch chan *structs.Configuration) {
 	}
 }
 
+// syncConfiguration fetches the desired configuration from the API
+func (c *Client) syncConfiguration() (*structs.DeviceSyncResponse, error) {
+
+	req := &structs.DeviceSyncRequest{
+		OrganizationID: c.config.OrganizationID,
+		ProjectID:      c.config.ProjectID,
+		BatchID:        c.config.DeviceBatchID,
+		DeviceID:       c.config.DeviceID,
+		DeviceRemoteID: c.config.DeviceRemoteID,
+	}
+
+	req.QueryOptions.AuthToken = c.Device().Token
+
+	ctx := context.TODO()
+
+	resp, err := c.api.Devices().SyncDevice(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Configuration == nil {
+		return nil, fmt.Errorf("empty configuration received")
+	}
+
+	return resp, nil
+}
+
 func (c *Client) tryToGetTokenUntilSuccessful() {
 
 	for {
@@ -415,23 +768,8 @@ func (c *Client) tryToGetTokenUntilSuccessful() {
 		default:
 		}
 
-		var err error
-		var resp *structs.DeviceTokenResponse
-
-		req := &structs.DeviceGetTokenRequest{
-			OrganizationID: c.config.OrganizationID,
-			ProjectID:      c.config.ProjectID,
-			BatchID:        c.config.DeviceBatchID,
-			DeviceID:       c.config.DeviceID,
-			SecretID:       c.config.DeviceSecret,
-		}
-
-		ctx := context.TODO()
-
-		if resp, err = c.api.Devices().GetDeviceToken(ctx, req); err == nil {
-			c.deviceLock.Lock()
-			c.device.Token = resp.Token
-			c.deviceLock.Unlock()
+		err := c.getToken()
+		if err == nil {
 			return
 		}
 
@@ -447,6 +785,31 @@ func (c *Client) tryToGetTokenUntilSuccessful() {
 	}
 }
 
+// getToken obtains an auth token for the device from the API
+func (c *Client) getToken() error {
+
+	req := &structs.DeviceGetTokenRequest{
+		OrganizationID: c.config.OrganizationID,
+		ProjectID:      c.config.ProjectID,
+		BatchID:        c.config.DeviceBatchID,
+		DeviceID:       c.config.DeviceID,
+		SecretID:       c.config.DeviceSecret,
+	}
+
+	ctx := context.TODO()
+
+	resp, err := c.api.Devices().GetDeviceToken(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	c.deviceLock.Lock()
+	c.device.Token = resp.Token
+	c.deviceLock.Unlock()
+
+	return nil
+}
+
 // Shutdown is used to tear down the client
 func (c *Client) Shutdown() error {
 	c.shutdownLock.Lock()
@@ -3,7 +3,9 @@ package client
 import (
 	"time"
 
+	state "github.com/seashell/agent/client/state"
 	log "github.com/seashell/agent/pkg/log"
+	structs "github.com/seashell/agent/seashell/structs"
 	version "github.com/seashell/agent/version"
 )
 
@@ -11,6 +13,36 @@ const (
 	defaultLogLevel  = "DEBUG"
 	defaultStateDir  = "/tmp/seashell"
 	defaultOutputDir = "/etc/seashell.d"
+
+	defaultHistorySize = 10
+
+	defaultStateRecovery = StateRecoveryRestore
+	defaultStateBackend  = StateBackendBoltDB
+)
+
+const (
+	// StateBackendBoltDB persists the client state to a BoltDB
+	// file within the state directory
+	StateBackendBoltDB = "boltdb"
+
+	// StateBackendInmem keeps the client state in memory, e.g. on read-only
+	// root filesystems. The state is lost once the client stops.
+	StateBackendInmem = "inmem"
+)
+
+const (
+	// StateRecoveryNone causes the client to fail to start
+	// in case its state is corrupted
+	StateRecoveryNone = "none"
+
+	// StateRecoveryReset causes a corrupted state to be moved
+	// aside, and the client to start from a fresh one
+	StateRecoveryReset = "reset"
+
+	// StateRecoveryRestore causes a corrupted state to be moved aside
+	// and replaced with its latest backup, or with a fresh state in
+	// case there are no valid backups
+	StateRecoveryRestore = "restore"
 )
 
 // Config : Seashell client configuration
@@ -32,15 +64,77 @@ type Config struct {
 	// StateDir is the directory used by the client to store its state.
 	StateDir string
 
+	// StateBackend is where the client state is stored,
+	// which is either "boltdb" or "inmem".
+	StateBackend string
+
+	// StateRepository is the repository in which the client state is
+	// stored. If set, it is used instead of the configured StateBackend,
+	// e.g. to share a repository between clients in tests.
+	StateRepository state.Repository
+
+	// StateRecovery is how the client recovers from a corrupted state,
+	// which is one of "none", "reset" or "restore".
+	StateRecovery string
+
 	// OutputDir is the directory to which the client will render its output.
 	OutputDir string
 
 	// ReconcileInterval is the interval between two reconciliation cycles.
 	ReconcileInterval time.Duration
 
+	// Validators contains the post-render validators of each module, keyed
+	// by module name. Modules without a validator are applied unchecked.
+	Validators map[string]*ValidatorConfig
+
+	// OverrideFile is the path to an HCL file whose values are deep-merged
+	// over the configuration received from the API.
+	OverrideFile string
+
+	// DriftReportOnly causes drift in rendered files to be
+	// reported without being repaired, e.g. while debugging.
+	DriftReportOnly bool
+
+	// HistorySize is the number of applied configuration versions kept
+	// in the client state for each module, which can be rolled back to.
+	HistorySize int
+
+	// HeartbeatInterval is the interval between two heartbeats.
+	HeartbeatInterval time.Duration
+
+	// Hooks contains the hooks defined in the local configuration
+	Hooks []*structs.Hook
+
+	// AllowRemoteHooks allows for hooks received from the API to be run
+	AllowRemoteHooks bool
+
+	// FileRoots are the directories under which the files
+	// module is allowed to manage files.
+	FileRoots []string
+
+	// Drago contains the local settings of the drago module
+	Drago *DragoConfig
+
+	// ContainerRuntime contains the local settings of the runtime module
+	ContainerRuntime *ContainerRuntimeConfig
+
 	// Meta contains client metadata
 	Meta map[string]string
 
+	// Facts contains the local settings of custom facts
+	Facts *FactsConfig
+
+	// MaintenanceWindows restrict when configuration changes received
+	// from the API are applied. Changes are applied right away if empty.
+	MaintenanceWindows []*MaintenanceWindow
+
+	// SelfUpdate contains the local settings of agent self-updates
+	SelfUpdate *SelfUpdateConfig
+
+	// FactsRoot is the directory under which /proc and /sys are read
+	// when collecting device facts, e.g. a fake root in tests.
+	FactsRoot string
+
 	// Version is the version of the Seashell client.
 	Version *version.VersionInfo
 
@@ -54,9 +148,19 @@ func DefaultConfig() *Config {
 		APIAddr:           "",
 		LogLevel:          defaultLogLevel,
 		StateDir:          defaultStateDir,
+		StateBackend:      defaultStateBackend,
+		StateRecovery:     defaultStateRecovery,
 		OutputDir:         defaultOutputDir,
 		ReconcileInterval: 5 * time.Second,
+		HeartbeatInterval: defaultHeartbeatInterval,
 		Meta:              map[string]string{},
+		FactsRoot:         defaultFactsRoot,
+		Validators:        map[string]*ValidatorConfig{},
+		HistorySize:       defaultHistorySize,
+		Drago:             DefaultDragoConfig(),
+		ContainerRuntime:  DefaultContainerRuntimeConfig(),
+		Facts:             DefaultFactsConfig(),
+		SelfUpdate:        DefaultSelfUpdateConfig(),
 		Version:           version.GetVersion(),
 	}
 }
@@ -95,6 +199,15 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.StateDir != "" {
 		result.StateDir = b.StateDir
 	}
+	if b.StateBackend != "" {
+		result.StateBackend = b.StateBackend
+	}
+	if b.StateRepository != nil {
+		result.StateRepository = b.StateRepository
+	}
+	if b.StateRecovery != "" {
+		result.StateRecovery = b.StateRecovery
+	}
 	if b.OutputDir != "" {
 		result.OutputDir = b.OutputDir
 	}
@@ -104,6 +217,60 @@ func (c *Config) Merge(b *Config) *Config {
 	if b.Meta != nil {
 		result.Meta = b.Meta
 	}
+	if b.FactsRoot != "" {
+		result.FactsRoot = b.FactsRoot
+	}
+	if b.Validators != nil {
+		result.Validators = b.Validators
+	}
+	if b.HistorySize != 0 {
+		result.HistorySize = b.HistorySize
+	}
+	if b.DriftReportOnly {
+		result.DriftReportOnly = true
+	}
+	if b.OverrideFile != "" {
+		result.OverrideFile = b.OverrideFile
+	}
+	if b.HeartbeatInterval != 0 {
+		result.HeartbeatInterval = b.HeartbeatInterval
+	}
+	if b.Hooks != nil {
+		result.Hooks = b.Hooks
+	}
+	if b.AllowRemoteHooks {
+		result.AllowRemoteHooks = true
+	}
+	if b.FileRoots != nil {
+		result.FileRoots = b.FileRoots
+	}
+	if result.Drago == nil && b.Drago != nil {
+		drago := *b.Drago
+		result.Drago = &drago
+	} else if b.Drago != nil {
+		result.Drago = result.Drago.Merge(b.Drago)
+	}
+	if result.Facts == nil && b.Facts != nil {
+		facts := *b.Facts
+		result.Facts = &facts
+	} else if b.Facts != nil {
+		result.Facts = result.Facts.Merge(b.Facts)
+	}
+	if b.MaintenanceWindows != nil {
+		result.MaintenanceWindows = b.MaintenanceWindows
+	}
+	if result.SelfUpdate == nil && b.SelfUpdate != nil {
+		update := *b.SelfUpdate
+		result.SelfUpdate = &update
+	} else if b.SelfUpdate != nil {
+		result.SelfUpdate = result.SelfUpdate.Merge(b.SelfUpdate)
+	}
+	if result.ContainerRuntime == nil && b.ContainerRuntime != nil {
+		runtime := *b.ContainerRuntime
+		result.ContainerRuntime = &runtime
+	} else if b.ContainerRuntime != nil {
+		result.ContainerRuntime = result.ContainerRuntime.Merge(b.ContainerRuntime)
+	}
 
 	return &result
 }
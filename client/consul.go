@@ -0,0 +1,42 @@
+package client
+
+import (
+	"path"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultConsulDatacenter = "global"
+
+	// consulTLSDir is the directory, relative to the output dir,
+	// to which the Consul TLS certificate material is written.
+	consulTLSDir = "consul-tls"
+)
+
+// consulTLSFiles returns the paths to which the CA certificate,
+// the certificate and the key used by Consul are written.
+func (c *Client) consulTLSFiles() (string, string, string) {
+	dir := path.Join(c.config.OutputDir, consulTLSDir)
+	return path.Join(dir, "ca.pem"), path.Join(dir, "cert.pem"), path.Join(dir, "key.pem")
+}
+
+// consulTLSFileContents returns the TLS certificate material of a Consul
+// configuration, keyed by the path of the file it is written to. Material
+// no longer present in the configuration maps to an empty string, so that
+// its file is removed.
+func (c *Client) consulTLSFileContents(config *structs.ConsulConfiguration) map[string]string {
+
+	tls := config.TLS
+	if tls == nil {
+		tls = &structs.ConsulTLS{}
+	}
+
+	ca, cert, key := c.consulTLSFiles()
+
+	return map[string]string{
+		ca:   tls.CA,
+		cert: tls.Cert,
+		key:  tls.Key,
+	}
+}
@@ -0,0 +1,240 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultWireguardPath     = "/usr/local/bin/wireguard"
+	defaultWireguardToolPath = "wg"
+
+	// defaultDragoInterfacePrefix is the default prefix of
+	// the names of the WireGuard interfaces managed by Drago.
+	defaultDragoInterfacePrefix = "dg-"
+
+	wireguardToolTimeout = 5 * time.Second
+)
+
+// DragoConfig contains the local settings of the drago module
+type DragoConfig struct {
+
+	// WireguardPath is the path to the WireGuard implementation used by Drago
+	WireguardPath string
+
+	// WireguardToolPath is the path to the wg tool, used to read
+	// back the state of the interfaces managed by Drago
+	WireguardToolPath string
+
+	// InterfacePrefix is the prefix of the names of the interfaces
+	// managed by Drago, to which Nomad and Consul are also bound
+	InterfacePrefix string
+
+	// ListenPort is the port on which Drago interfaces listen.
+	// If zero, the port is chosen by Drago.
+	ListenPort int
+}
+
+// DefaultDragoConfig returns the default settings of the drago module
+func DefaultDragoConfig() *DragoConfig {
+	return &DragoConfig{
+		WireguardPath:     defaultWireguardPath,
+		WireguardToolPath: defaultWireguardToolPath,
+		InterfacePrefix:   defaultDragoInterfacePrefix,
+	}
+}
+
+// Merge combines two DragoConfig structs, returning the result
+func (c *DragoConfig) Merge(b *DragoConfig) *DragoConfig {
+	result := *c
+
+	if b.WireguardPath != "" {
+		result.WireguardPath = b.WireguardPath
+	}
+	if b.WireguardToolPath != "" {
+		result.WireguardToolPath = b.WireguardToolPath
+	}
+	if b.InterfacePrefix != "" {
+		result.InterfacePrefix = b.InterfacePrefix
+	}
+	if b.ListenPort != 0 {
+		result.ListenPort = b.ListenPort
+	}
+
+	return &result
+}
+
+// DragoInterfaces returns the state of the WireGuard interfaces
+// managed by Drago, including per-peer handshakes and transfer counters.
+func (c *Client) DragoInterfaces() ([]*structs.WireguardInterface, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), wireguardToolTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, c.config.Drago.WireguardToolPath, "show", "all", "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running wireguard tool: %v", err)
+	}
+
+	return parseWireguardDump(out, c.config.Drago.InterfacePrefix, time.Now())
+}
+
+// dragoPeerAddresses returns the overlay addresses of the peers of the
+// WireGuard interfaces managed by Drago, which are used as a fallback
+// for joining Nomad and Consul clusters when the remote configuration
+// does not specify which servers to join.
+func (c *Client) dragoPeerAddresses() []string {
+
+	ifaces, err := c.DragoInterfaces()
+	if err != nil {
+		c.logger.Debugf("could not discover drago peers: %v", err)
+		return []string{}
+	}
+
+	set := map[string]struct{}{}
+
+	for _, iface := range ifaces {
+		for _, peer := range iface.Peers {
+			for _, s := range peer.AllowedIPs {
+				ip, ipnet, err := net.ParseCIDR(s)
+				if err != nil {
+					continue
+				}
+				// Only consider host addresses, i.e. /32 and /128
+				if ones, bits := ipnet.Mask.Size(); ones != bits {
+					continue
+				}
+				set[ip.String()] = struct{}{}
+			}
+		}
+	}
+
+	addrs := make([]string, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs
+}
+
+// parseWireguardDump parses the output of `wg show all dump`, returning
+// the interfaces whose names start with prefix. The output contains one
+// tab-separated line per interface, in the format
+//
+//	<interface> <private key> <public key> <listen port> <fwmark>
+//
+// followed by one line per peer of the interface, in the format
+//
+//	<interface> <public key> <preshared key> <endpoint> <allowed ips>
+//	<latest handshake> <transfer rx> <transfer tx> <persistent keepalive>
+//
+// Private and preshared keys are never included in the result.
+func parseWireguardDump(out []byte, prefix string, now time.Time) ([]*structs.WireguardInterface, error) {
+
+	ifaces := []*structs.WireguardInterface{}
+	byName := map[string]*structs.WireguardInterface{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+
+		if !strings.HasPrefix(fields[0], prefix) {
+			continue
+		}
+
+		switch len(fields) {
+		case 5:
+			port, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid listen port in line %q", line)
+			}
+			iface := &structs.WireguardInterface{
+				Name:       fields[0],
+				PublicKey:  fields[2],
+				ListenPort: port,
+				Peers:      []*structs.WireguardPeer{},
+			}
+			ifaces = append(ifaces, iface)
+			byName[iface.Name] = iface
+
+		case 9:
+			iface, ok := byName[fields[0]]
+			if !ok {
+				return nil, fmt.Errorf("peer of unknown interface in line %q", line)
+			}
+			peer, err := parseWireguardPeer(fields, now)
+			if err != nil {
+				return nil, fmt.Errorf("%v in line %q", err, line)
+			}
+			iface.Peers = append(iface.Peers, peer)
+
+		default:
+			return nil, fmt.Errorf("unexpected line: %q", line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ifaces, nil
+}
+
+func parseWireguardPeer(fields []string, now time.Time) (*structs.WireguardPeer, error) {
+
+	peer := &structs.WireguardPeer{
+		PublicKey:  fields[1],
+		AllowedIPs: []string{},
+	}
+
+	if fields[3] != "(none)" {
+		peer.Endpoint = fields[3]
+	}
+
+	if fields[4] != "(none)" {
+		peer.AllowedIPs = strings.Split(fields[4], ",")
+	}
+
+	handshake, err := strconv.ParseInt(fields[5], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latest handshake")
+	}
+	if handshake > 0 {
+		t := time.Unix(handshake, 0)
+		peer.LatestHandshake = &t
+		peer.HandshakeAge = now.Sub(t).Round(time.Second).String()
+	}
+
+	if peer.ReceiveBytes, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid transfer rx")
+	}
+
+	if peer.TransmitBytes, err = strconv.ParseInt(fields[7], 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid transfer tx")
+	}
+
+	if fields[8] != "off" {
+		if peer.PersistentKeepalive, err = strconv.Atoi(fields[8]); err != nil {
+			return nil, fmt.Errorf("invalid persistent keepalive")
+		}
+	}
+
+	return peer, nil
+}
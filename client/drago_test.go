@@ -0,0 +1,79 @@
+package client
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWireguardDump(t *testing.T) {
+
+	out, err := ioutil.ReadFile("testdata/wireguard/dump.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000090, 0)
+
+	ifaces, err := parseWireguardDump(out, "dg-", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interfaces without the prefix are skipped
+	if len(ifaces) != 2 || ifaces[0].Name != "dg-0" || ifaces[1].Name != "dg-1" {
+		t.Fatalf("unexpected interfaces: %+v", ifaces)
+	}
+
+	iface := ifaces[0]
+	if iface.PublicKey != "HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=" || iface.ListenPort != 51820 {
+		t.Fatalf("unexpected interface: %+v", iface)
+	}
+	if len(iface.Peers) != 3 {
+		t.Fatalf("unexpected peers: %+v", iface.Peers)
+	}
+	if len(ifaces[1].Peers) != 0 {
+		t.Fatalf("unexpected peers of dg-1: %+v", ifaces[1].Peers)
+	}
+
+	// Recent handshake
+	p := iface.Peers[0]
+	if p.Endpoint != "203.0.113.10:51820" || !reflect.DeepEqual(p.AllowedIPs, []string{"10.10.0.1/32", "10.1.0.0/16"}) {
+		t.Errorf("unexpected peer: %+v", p)
+	}
+	if p.LatestHandshake == nil || !p.LatestHandshake.Equal(time.Unix(1700000000, 0)) || p.HandshakeAge != "1m30s" {
+		t.Errorf("unexpected handshake of peer: %+v", p)
+	}
+	if p.ReceiveBytes != 1048576 || p.TransmitBytes != 524288 || p.PersistentKeepalive != 25 {
+		t.Errorf("unexpected counters of peer: %+v", p)
+	}
+
+	// Stale handshake
+	p = iface.Peers[1]
+	if p.LatestHandshake == nil || p.HandshakeAge != "3h1m30s" || p.PersistentKeepalive != 0 {
+		t.Errorf("unexpected handshake of stale peer: %+v", p)
+	}
+
+	// No handshake yet, nor endpoint
+	p = iface.Peers[2]
+	if p.LatestHandshake != nil || p.HandshakeAge != "" || p.Endpoint != "" || p.ReceiveBytes != 0 {
+		t.Errorf("unexpected handshake of peer without handshake: %+v", p)
+	}
+}
+
+func TestParseWireguardDump_Invalid(t *testing.T) {
+
+	cases := map[string]string{
+		"unknown interface": "dg-0\tKEY\t(none)\t(none)\t10.10.0.1/32\t0\t0\t0\toff\n",
+		"invalid port":      "dg-0\tPRIV\tPUB\tport\toff\n",
+		"invalid handshake": "dg-0\tPRIV\tPUB\t51820\toff\ndg-0\tKEY\t(none)\t(none)\t10.10.0.1/32\tnever\t0\t0\toff\n",
+		"unexpected line":   "dg-0\tPRIV\n",
+	}
+
+	for name, out := range cases {
+		if _, err := parseWireguardDump([]byte(out), "dg-", time.Now()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// checkRenderedFileDrift checks whether the file rendered by a template-based
+// module, or any of the files referenced by it, keyed by path, was modified
+// or deleted, repairing them by rendering the configuration again.
+func (c *Client) checkRenderedFileDrift(tx state.Transaction, module string, tmpl string, config interface{}, files map[string]string) error {
+
+	out := path.Join(c.config.OutputDir, module+".hcl")
+
+	expected := map[string]string{}
+
+	sum, err := tx.FileChecksum(out)
+	if err != nil {
+		return err
+	}
+
+	// Files rendered before checksums were kept in the state
+	// are compared against the render of the stored configuration
+	if sum == "" {
+		content, err := renderTemplate(tmpl, config)
+		if err != nil {
+			return err
+		}
+		sum = checksum(content)
+		if err := tx.SetFileChecksum(out, sum); err != nil {
+			return err
+		}
+	}
+
+	expected[out] = sum
+
+	for p, content := range files {
+
+		if content == "" {
+			continue
+		}
+
+		sum, err := tx.FileChecksum(p)
+		if err != nil {
+			return err
+		}
+
+		if sum == "" {
+			sum = checksum([]byte(content))
+			if err := tx.SetFileChecksum(p, sum); err != nil {
+				return err
+			}
+		}
+
+		expected[p] = sum
+	}
+
+	// Files rendered before they were restricted to their owner
+	// are not repaired, but their mode is restricted right away
+	restrictFileMode(out, moduleFileMode)
+
+	return c.repairDrift(module, expected, func() error {
+		return c.renderModuleFile(tx, module, tmpl, config, files)
+	})
+}
+
+// restrictFileMode removes the permissions of a file which are not
+// in mode, in case it exists
+func restrictFileMode(p string, mode os.FileMode) {
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return
+	}
+
+	if info.Mode().Perm()&^mode != 0 {
+		os.Chmod(p, info.Mode().Perm()&mode)
+	}
+}
+
+// repairDrift compares the checksums of files on disk against the expected
+// ones, keyed by path. If any of the files drifted, a drift event is emitted
+// and, unless drift is only to be reported, the files are repaired.
+func (c *Client) repairDrift(module string, expected map[string]string, repair func() error) error {
+
+	drifted := []string{}
+
+	for p, sum := range expected {
+		ok, err := hasDrifted(p, sum)
+		if err != nil {
+			return err
+		}
+		if ok {
+			drifted = append(drifted, p)
+		}
+	}
+
+	if len(drifted) == 0 {
+		return nil
+	}
+
+	sort.Strings(drifted)
+
+	c.metrics.incr("drift." + module)
+
+	if c.config.DriftReportOnly {
+		c.emitEvent(structs.EventTypeWarning, module, "drift detected in %s, not repairing it (report only)", strings.Join(drifted, ", "))
+		return nil
+	}
+
+	c.emitEvent(structs.EventTypeWarning, module, "drift detected in %s, repairing it", strings.Join(drifted, ", "))
+
+	if err := repair(); err != nil {
+		return fmt.Errorf("error repairing drift: %v", err)
+	}
+
+	return nil
+}
+
+// hasDrifted returns true if the file at path p is missing,
+// or if its content does not match the expected checksum.
+func hasDrifted(p string, expected string) (bool, error) {
+
+	buf, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return checksum(buf) != expected, nil
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultEventLogSize = 100
+)
+
+// eventLog is a bounded, in-memory log of client events.
+type eventLog struct {
+	size   int
+	events []*structs.Event
+	lock   sync.Mutex
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{
+		size:   size,
+		events: []*structs.Event{},
+	}
+}
+
+func (l *eventLog) append(e *structs.Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.events = append(l.events, e)
+	if len(l.events) > l.size {
+		l.events = l.events[len(l.events)-l.size:]
+	}
+}
+
+func (l *eventLog) list() []*structs.Event {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	out := make([]*structs.Event, len(l.events))
+	copy(out, l.events)
+
+	return out
+}
+
+// Events returns the most recent events emitted by the client
+func (c *Client) Events() []*structs.Event {
+	return c.events.list()
+}
+
+// emitEvent records an event in the client event log, also
+// logging it at the level corresponding to its type.
+func (c *Client) emitEvent(typ, module, format string, args ...interface{}) {
+
+	e := &structs.Event{
+		Type:      typ,
+		Module:    module,
+		Message:   fmt.Sprintf(format, args...),
+		Timestamp: time.Now(),
+	}
+
+	switch typ {
+	case structs.EventTypeError:
+		c.logger.Errorf("%s: %s", module, e.Message)
+	case structs.EventTypeWarning:
+		c.logger.Warnf("%s: %s", module, e.Message)
+	default:
+		c.logger.Infof("%s: %s", module, e.Message)
+	}
+
+	c.events.append(e)
+}
@@ -0,0 +1,291 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// defaultFactsTTL is how long collected facts are reused
+	// before being collected again
+	defaultFactsTTL = 1 * time.Minute
+
+	defaultFactsRoot = "/"
+)
+
+// factsCache keeps the facts last collected, and the
+// output of the latest run of each custom facts executable
+type factsCache struct {
+	lock   sync.Mutex
+	facts  *structs.DeviceFacts
+	custom map[string]*customFactsResult
+}
+
+// Facts returns the facts of the device, which are collected again in case
+// they are older than defaultFactsTTL, merged with the custom facts.
+func (c *Client) Facts() *structs.DeviceFacts {
+
+	c.facts.lock.Lock()
+	defer c.facts.lock.Unlock()
+
+	if c.facts.facts == nil || time.Since(c.facts.facts.Timestamp) > defaultFactsTTL {
+		c.facts.facts = c.collectFacts()
+	}
+
+	facts := *c.facts.facts
+	facts.Custom = c.customFacts()
+
+	return &facts
+}
+
+// collectFacts gathers the facts of the device from /proc and /sys, which
+// are read under FactsRoot, so that a fake root can be used. Facts which
+// cannot be read, e.g. on systems other than Linux, are left empty.
+func (c *Client) collectFacts() *structs.DeviceFacts {
+
+	root := c.config.FactsRoot
+
+	f := &structs.DeviceFacts{
+		Hostname:      readFactFile(root, "proc/sys/kernel/hostname"),
+		OS:            runtime.GOOS,
+		KernelVersion: readFactFile(root, "proc/sys/kernel/osrelease"),
+		Arch:          normalizeArch(readFactFile(root, "proc/sys/kernel/arch")),
+		CPU:           cpuFacts(root),
+		Memory:        memoryFacts(root),
+		Disk:          diskFacts(filepath.Join(root, c.config.StateDir)),
+		Network:       networkFacts(root),
+		Uptime:        uptime(root),
+		Timestamp:     time.Now(),
+	}
+
+	if f.Hostname == "" && root == defaultFactsRoot {
+		f.Hostname, _ = os.Hostname()
+	}
+
+	if f.Arch == "" {
+		f.Arch = runtime.GOARCH
+	}
+
+	if f.Disk != nil {
+		f.Disk.Path = c.config.StateDir
+	}
+
+	release := parseKeyValues(readFactFile(root, "etc/os-release"))
+	f.Distribution = release["ID"]
+	f.DistributionVersion = release["VERSION_ID"]
+
+	if c.config.Version != nil {
+		f.Version = c.config.Version.VersionNumber()
+	}
+
+	return f
+}
+
+// kernelArchs maps the architecture names used by the kernel to those
+// used by Go, e.g. x86_64 to amd64, so that the architecture fact uses
+// the same naming whether it is read from the kernel or not
+var kernelArchs = map[string]string{
+	"x86_64":  "amd64",
+	"i386":    "386",
+	"i486":    "386",
+	"i586":    "386",
+	"i686":    "386",
+	"aarch64": "arm64",
+	"armv5l":  "arm",
+	"armv6l":  "arm",
+	"armv7l":  "arm",
+	"armv8l":  "arm",
+	"mips":    "mips",
+	"mips64":  "mips64",
+	"ppc64":   "ppc64",
+	"ppc64le": "ppc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// normalizeArch returns the Go name of an architecture
+// reported by the kernel, or the name itself if unknown
+func normalizeArch(arch string) string {
+	if a, ok := kernelArchs[arch]; ok {
+		return a
+	}
+	return arch
+}
+
+func readFactFile(root string, name string) string {
+	buf, err := ioutil.ReadFile(filepath.Join(root, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// parseKeyValues parses lines of key=value pairs,
+// whose values may be quoted, e.g. /etc/os-release
+func parseKeyValues(s string) map[string]string {
+
+	out := map[string]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		out[strings.TrimSpace(parts[0])] = value
+	}
+
+	return out
+}
+
+// cpuFacts parses /proc/cpuinfo. The model is taken from the "model name"
+// field on x86, or from the "Model" field on ARM boards, falling back
+// to the "Hardware" field on older ARM kernels.
+func cpuFacts(root string) *structs.CPUFacts {
+
+	info := readFactFile(root, "proc/cpuinfo")
+	if info == "" {
+		return nil
+	}
+
+	f := &structs.CPUFacts{}
+	hardware := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch key {
+		case "processor":
+			f.Count++
+		case "model name", "Model":
+			if f.Model == "" {
+				f.Model = value
+			}
+		case "Hardware":
+			hardware = value
+		}
+	}
+
+	if f.Model == "" {
+		f.Model = hardware
+	}
+
+	return f
+}
+
+// memoryFacts parses /proc/meminfo, whose values are in kB
+func memoryFacts(root string) *structs.MemoryFacts {
+
+	info := readFactFile(root, "proc/meminfo")
+	if info == "" {
+		return nil
+	}
+
+	f := &structs.MemoryFacts{}
+
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			f.TotalBytes = v * 1024
+		case "MemAvailable:":
+			f.AvailableBytes = v * 1024
+		}
+	}
+
+	return f
+}
+
+// networkFacts lists the network interfaces under /sys/class/net, except
+// for the loopback one. Addresses can only be read from the running
+// system, and are therefore omitted when using a fake root.
+func networkFacts(root string) []*structs.NetworkFacts {
+
+	dir := filepath.Join(root, "sys/class/net")
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	out := []*structs.NetworkFacts{}
+
+	for _, e := range entries {
+
+		name := e.Name()
+		if name == "lo" {
+			continue
+		}
+
+		f := &structs.NetworkFacts{
+			Name: name,
+			MAC:  readFactFile(dir, filepath.Join(name, "address")),
+			Up:   readFactFile(dir, filepath.Join(name, "operstate")) == "up",
+		}
+
+		f.MTU, _ = strconv.Atoi(readFactFile(dir, filepath.Join(name, "mtu")))
+
+		if root == defaultFactsRoot {
+			if iface, err := net.InterfaceByName(name); err == nil {
+				if addrs, err := iface.Addrs(); err == nil {
+					for _, addr := range addrs {
+						f.Addresses = append(f.Addresses, addr.String())
+					}
+				}
+			}
+		}
+
+		out = append(out, f)
+	}
+
+	return out
+}
+
+// uptime returns the uptime in seconds, read from /proc/uptime
+func uptime(root string) int64 {
+
+	fields := bytes.Fields([]byte(readFactFile(root, "proc/uptime")))
+	if len(fields) == 0 {
+		return 0
+	}
+
+	v, err := strconv.ParseFloat(string(fields[0]), 64)
+	if err != nil {
+		return 0
+	}
+
+	return int64(v)
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultCustomFactsTTL     = 5 * time.Minute
+	defaultCustomFactsTimeout = 10 * time.Second
+)
+
+// FactsConfig contains the local settings of custom facts
+type FactsConfig struct {
+
+	// Dir is the directory containing the executables whose
+	// output is merged into the device facts and meta
+	Dir string
+
+	// TTL is how long the output of an executable is reused
+	// before the executable is run again
+	TTL time.Duration
+
+	// Timeout is the maximum duration of a run of an executable
+	Timeout time.Duration
+}
+
+// DefaultFactsConfig returns the default settings of custom facts
+func DefaultFactsConfig() *FactsConfig {
+	return &FactsConfig{
+		TTL:     defaultCustomFactsTTL,
+		Timeout: defaultCustomFactsTimeout,
+	}
+}
+
+// Merge combines two FactsConfig structs, returning the result
+func (c *FactsConfig) Merge(b *FactsConfig) *FactsConfig {
+	result := *c
+
+	if b.Dir != "" {
+		result.Dir = b.Dir
+	}
+	if b.TTL != 0 {
+		result.TTL = b.TTL
+	}
+	if b.Timeout != 0 {
+		result.Timeout = b.Timeout
+	}
+
+	return &result
+}
+
+// customFactsResult is the output of the latest run of an executable
+type customFactsResult struct {
+	facts map[string]string
+	ranAt time.Time
+}
+
+// Meta returns the client metadata sent to the API, i.e. the custom facts
+// overlaid with the meta defined in the local configuration, whose
+// references to device facts are interpolated.
+func (c *Client) Meta() map[string]string {
+
+	meta, err := c.interpolatedMeta(c.Facts())
+	if err != nil {
+		c.logger.Debugf("could not interpolate client meta: %v", err)
+	}
+
+	return meta
+}
+
+// customFacts runs the executables in the facts directory whose output is
+// older than the configured TTL, and returns the facts they emitted keyed by
+// "<executable>.<key>", where the executable name excludes its extension.
+// Executables which fail keep reporting their previous output until they
+// are run again. It must be called with the facts cache lock held.
+func (c *Client) customFacts() map[string]string {
+
+	config := c.config.Facts
+	if config == nil || config.Dir == "" {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(config.Dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.emitEvent(structs.EventTypeWarning, "facts", "could not read facts directory: %v", err)
+		}
+		return nil
+	}
+
+	previous := c.facts.custom
+	c.facts.custom = map[string]*customFactsResult{}
+
+	out := map[string]string{}
+
+	for _, e := range entries {
+
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || e.Mode()&0111 == 0 {
+			continue
+		}
+
+		result, ok := previous[e.Name()]
+		if !ok || time.Since(result.ranAt) >= config.TTL {
+			result = c.runCustomFacts(filepath.Join(config.Dir, e.Name()), result)
+		}
+
+		c.facts.custom[e.Name()] = result
+
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		for k, v := range result.facts {
+			out[name+"."+k] = v
+		}
+	}
+
+	return out
+}
+
+// runCustomFacts runs an executable of the facts directory, parsing its
+// output. If it fails, the facts of its previous run are kept.
+func (c *Client) runCustomFacts(path string, previous *customFactsResult) *customFactsResult {
+
+	result := &customFactsResult{ranAt: time.Now()}
+	if previous != nil {
+		result.facts = previous.facts
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.Facts.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(),
+		"SEASHELL_DEVICE_ID="+c.config.DeviceID,
+		"SEASHELL_DEVICE_REMOTE_ID="+c.config.DeviceRemoteID,
+	)
+
+	c.logger.Debugf("collecting custom facts from %s", path)
+
+	out, err := runCommandWithStdout(cmd)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", c.config.Facts.Timeout)
+	}
+	if err != nil {
+		c.emitEvent(structs.EventTypeWarning, "facts", "custom facts %s failed: %v", filepath.Base(path), err)
+		return result
+	}
+
+	facts, err := parseCustomFacts(out)
+	if err != nil {
+		c.emitEvent(structs.EventTypeWarning, "facts", "invalid output of custom facts %s: %v", filepath.Base(path), err)
+		return result
+	}
+
+	result.facts = facts
+
+	return result
+}
+
+// parseCustomFacts parses the output of a custom facts executable, which is
+// either a JSON object, whose nested keys are joined with dots, or lines of
+// key=value pairs.
+func parseCustomFacts(out []byte) (map[string]string, error) {
+
+	out = bytes.TrimSpace(out)
+
+	if !bytes.HasPrefix(out, []byte("{")) {
+		return parseKeyValues(string(out)), nil
+	}
+
+	var obj map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	facts := map[string]string{}
+	flattenFacts(facts, "", obj)
+
+	return facts, nil
+}
+
+func flattenFacts(out map[string]string, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		key := prefix + k
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenFacts(out, key+".", v)
+		case string:
+			out[key] = v
+		case json.Number:
+			out[key] = v.String()
+		case bool:
+			out[key] = strconv.FormatBool(v)
+		case nil:
+			out[key] = ""
+		default:
+			encoded, _ := json.Marshal(v)
+			out[key] = string(encoded)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package client
+
+import (
+	"syscall"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// diskFacts returns the usage of the filesystem containing path
+func diskFacts(path string) *structs.DiskFacts {
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return nil
+	}
+
+	return &structs.DiskFacts{
+		TotalBytes: stat.Blocks * uint64(stat.Bsize),
+		FreeBytes:  stat.Bavail * uint64(stat.Bsize),
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// diskFacts is only supported on Linux
+func diskFacts(path string) *structs.DiskFacts {
+	return nil
+}
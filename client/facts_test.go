@@ -0,0 +1,92 @@
+package client
+
+import (
+	"runtime"
+	"testing"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+func TestCollectFacts(t *testing.T) {
+
+	c := testClient(t, &Config{FactsRoot: "testdata/facts/x86"})
+
+	f := c.collectFacts()
+
+	if f.Hostname != "edge-01" {
+		t.Errorf("unexpected hostname %q", f.Hostname)
+	}
+	if f.KernelVersion != "5.10.0-21-amd64" {
+		t.Errorf("unexpected kernel version %q", f.KernelVersion)
+	}
+	if f.Arch != "amd64" {
+		t.Errorf("unexpected arch %q", f.Arch)
+	}
+	if f.Distribution != "debian" || f.DistributionVersion != "11" {
+		t.Errorf("unexpected distribution %q %q", f.Distribution, f.DistributionVersion)
+	}
+	if f.Uptime != 3600 {
+		t.Errorf("unexpected uptime %d", f.Uptime)
+	}
+
+	if f.CPU == nil || f.CPU.Count != 2 || f.CPU.Model != "Intel(R) Celeron(R) J4125 CPU @ 2.00GHz" {
+		t.Errorf("unexpected cpu facts %+v", f.CPU)
+	}
+
+	if f.Memory == nil || f.Memory.TotalBytes != 8041388*1024 || f.Memory.AvailableBytes != 6291456*1024 {
+		t.Errorf("unexpected memory facts %+v", f.Memory)
+	}
+
+	expected := map[string]*structs.NetworkFacts{
+		"eth0":  {Name: "eth0", MAC: "52:54:00:12:34:56", MTU: 1500, Up: true},
+		"wlan0": {Name: "wlan0", MAC: "dc:a6:32:00:00:01", MTU: 1500, Up: false},
+	}
+
+	if len(f.Network) != len(expected) {
+		t.Fatalf("unexpected network facts %+v", f.Network)
+	}
+	for _, n := range f.Network {
+		e, ok := expected[n.Name]
+		if !ok || n.MAC != e.MAC || n.MTU != e.MTU || n.Up != e.Up || len(n.Addresses) != 0 {
+			t.Errorf("unexpected facts of interface %s: %+v", n.Name, n)
+		}
+	}
+}
+
+func TestCollectFacts_ARM(t *testing.T) {
+
+	c := testClient(t, &Config{FactsRoot: "testdata/facts/arm"})
+
+	f := c.collectFacts()
+
+	if f.CPU == nil || f.CPU.Count != 2 || f.CPU.Model != "Raspberry Pi 4 Model B Rev 1.1" {
+		t.Errorf("unexpected cpu facts %+v", f.CPU)
+	}
+
+	// Without /proc/sys/kernel/arch, the architecture of the agent is used
+	if f.Arch != runtime.GOARCH {
+		t.Errorf("unexpected arch %q", f.Arch)
+	}
+
+	if f.Memory != nil || f.Network != nil || f.Uptime != 0 {
+		t.Errorf("unexpected facts missing from the root: %+v", f)
+	}
+}
+
+func TestNormalizeArch(t *testing.T) {
+
+	cases := map[string]string{
+		"x86_64":  "amd64",
+		"aarch64": "arm64",
+		"armv7l":  "arm",
+		"i686":    "386",
+		"amd64":   "amd64",
+		"sparc":   "sparc",
+	}
+
+	for in, out := range cases {
+		if got := normalizeArch(in); got != out {
+			t.Errorf("normalizeArch(%q) = %q, expected %q", in, got, out)
+		}
+	}
+}
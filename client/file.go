@@ -0,0 +1,312 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultManagedFileMode = "0644"
+	managedFileDirMode     = 0755
+)
+
+// fileTemplateData is the data available to the templates of managed files
+type fileTemplateData struct {
+	Name string
+	Meta map[string]string
+}
+
+// desiredFilesConfiguration renders the files listed in the remote
+// configuration, failing if any of them is invalid, e.g. because its
+// path is outside of the allowed roots or its checksum does not match.
+func (c *Client) desiredFilesConfiguration(config *structs.Configuration) (*structs.FilesConfiguration, error) {
+
+	desired := &structs.FilesConfiguration{
+		Files: []*structs.ManagedFile{},
+	}
+
+	seen := map[string]struct{}{}
+
+	for _, f := range config.Files {
+
+		p, err := c.managedFilePath(f.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := seen[p]; ok {
+			return nil, fmt.Errorf("file %s is listed more than once", p)
+		}
+		seen[p] = struct{}{}
+
+		if f.Content != "" && f.Template != "" {
+			return nil, fmt.Errorf("file %s must have either content or a template, not both", p)
+		}
+
+		content := []byte(f.Content)
+		if f.Template != "" {
+			data := &fileTemplateData{
+				Name: c.config.DeviceRemoteID,
+				Meta: config.Labels,
+			}
+			if content, err = renderTemplate(f.Template, data); err != nil {
+				return nil, fmt.Errorf("file %s: %v", p, err)
+			}
+		}
+
+		mode := f.Mode
+		if mode == "" {
+			mode = defaultManagedFileMode
+		}
+		if _, err := parseFileMode(mode); err != nil {
+			return nil, fmt.Errorf("file %s: %v", p, err)
+		}
+
+		if f.Owner != "" {
+			if _, _, err := lookupOwner(f.Owner); err != nil {
+				return nil, fmt.Errorf("file %s: %v", p, err)
+			}
+		}
+
+		sum := checksum(content)
+
+		if f.Checksum != "" && !strings.EqualFold(f.Checksum, sum) {
+			return nil, fmt.Errorf("file %s: checksum mismatch (expected %s, got %s)", p, f.Checksum, sum)
+		}
+
+		desired.Files = append(desired.Files, &structs.ManagedFile{
+			Path:     p,
+			Content:  string(content),
+			Mode:     mode,
+			Owner:    f.Owner,
+			Checksum: sum,
+		})
+	}
+
+	return desired, nil
+}
+
+func (c *Client) reconcileFilesConfiguration(tx state.Transaction, config, remote *structs.Configuration) error {
+
+	desired, err := c.desiredFilesConfiguration(config)
+	if err != nil {
+		c.emitEvent(structs.EventTypeWarning, "files", "invalid files configuration: %v", err)
+		return err
+	}
+
+	if pinned := (&structs.FilesConfiguration{}); c.pinnedConfiguration(tx, "files", remote, pinned) {
+		desired = pinned
+	}
+
+	current, err := tx.FilesConfiguration()
+	if err != nil {
+		c.logger.Errorf("could not read files configuration: %v", err)
+	}
+
+	if current.Hash() != desired.Hash() {
+
+		c.logger.Debugf("changes detected in files configuration. writing files and persisting to repository...")
+
+		if err := c.applyManagedFiles(current, desired); err != nil {
+			return err
+		}
+
+		if err := tx.SetFilesConfiguration(desired); err != nil {
+			return err
+		}
+
+		c.recordConfigurationChange(tx, "files", current, desired)
+		c.recordConfigurationVersion(tx, "files", desired, nil)
+		c.moduleChanged("files")
+
+		return nil
+	}
+
+	c.logger.Debugf("no changes detected in files configuration. checking for drift...")
+
+	expected := map[string]string{}
+	for _, f := range current.Files {
+		expected[f.Path] = f.Checksum
+	}
+
+	return c.repairDrift("files", expected, func() error {
+		return c.applyManagedFiles(nil, current)
+	})
+}
+
+// applyManagedFiles writes the desired files, and deletes the
+// files which were previously managed but are no longer desired.
+func (c *Client) applyManagedFiles(current, desired *structs.FilesConfiguration) error {
+
+	keep := map[string]struct{}{}
+
+	for _, f := range desired.Files {
+		if err := writeManagedFile(f); err != nil {
+			return fmt.Errorf("error writing %s: %v", f.Path, err)
+		}
+		keep[f.Path] = struct{}{}
+	}
+
+	if current == nil {
+		return nil
+	}
+
+	for _, f := range current.Files {
+
+		if _, ok := keep[f.Path]; ok {
+			continue
+		}
+
+		// Files are only deleted if they are still under an allowed
+		// root, in case the allowlist changed since they were written.
+		if _, err := c.managedFilePath(f.Path); err != nil {
+			c.emitEvent(structs.EventTypeWarning, "files", "not deleting %s: %v", f.Path, err)
+			continue
+		}
+
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error deleting %s: %v", f.Path, err)
+		}
+
+		c.emitEvent(structs.EventTypeInfo, "files", "deleted %s", f.Path)
+	}
+
+	return nil
+}
+
+// writeManagedFile atomically writes a managed file, setting
+// its mode and owner before it replaces the existing one.
+func writeManagedFile(f *structs.ManagedFile) error {
+
+	mode, err := parseFileMode(f.Mode)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), managedFileDirMode); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+
+	tmp, err := writeTempFile(f.Path, []byte(f.Content), mode)
+	if err != nil {
+		return err
+	}
+
+	if f.Owner != "" {
+		uid, gid, err := lookupOwner(f.Owner)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Chown(tmp, uid, gid); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("error setting file owner: %v", err)
+		}
+	}
+
+	if err := os.Rename(tmp, f.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing file: %v", err)
+	}
+
+	return nil
+}
+
+// managedFilePath returns the cleaned path of a managed file, or an error
+// in case it is not located under any of the allowed roots, including
+// when the path escapes the roots through symbolic links.
+func (c *Client) managedFilePath(p string) (string, error) {
+
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("path %q is not absolute", p)
+	}
+
+	p = filepath.Clean(p)
+	resolved := filepath.Join(resolveSymlinks(filepath.Dir(p)), filepath.Base(p))
+
+	for _, root := range c.config.FileRoots {
+		root = filepath.Clean(root)
+		if isUnder(root, p) && isUnder(resolveSymlinks(root), resolved) {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("path %q is not under any of the allowed file roots", p)
+}
+
+// isUnder returns true if path p is located under directory root
+func isUnder(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveSymlinks resolves the symbolic links in the longest
+// existing prefix of path p, leaving the rest of it unchanged.
+func resolveSymlinks(p string) string {
+
+	dir, rest := p, ""
+
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return p
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+}
+
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// lookupOwner returns the uid and gid of an owner in the format "user[:group]".
+// If no group is given, the primary group of the user is used.
+func lookupOwner(owner string) (int, int, error) {
+
+	parts := strings.SplitN(owner, ":", 2)
+
+	u, err := user.Lookup(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unknown user %q", parts[0])
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 2 {
+		g, err := user.LookupGroup(parts[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("unknown group %q", parts[1])
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uid, gid, nil
+}
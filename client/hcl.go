@@ -0,0 +1,101 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var hclIdentifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// hclList formats a list of strings as an HCL list, e.g. ["a", "b"]
+func hclList(in []string) string {
+	quoted := make([]string, 0, len(in))
+	for _, s := range in {
+		quoted = append(quoted, strconv.Quote(s))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// hclBody formats a map, as decoded from JSON, as the body of an HCL block
+// indented by the given number of spaces. Nested maps are formatted as
+// nested blocks, and lists of maps as repeated blocks.
+func hclBody(in map[string]interface{}, indent int) string {
+
+	pad := strings.Repeat(" ", indent)
+
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+
+	for _, k := range keys {
+
+		name := k
+		if !hclIdentifierRegexp.MatchString(k) {
+			name = strconv.Quote(k)
+		}
+
+		switch v := in[k].(type) {
+		case nil:
+			continue
+		case map[string]interface{}:
+			lines = append(lines, fmt.Sprintf("%s%s {\n%s%s}", pad, name, hclBody(v, indent+2), pad))
+		case []interface{}:
+			if isListOfMaps(v) {
+				for _, e := range v {
+					lines = append(lines, fmt.Sprintf("%s%s {\n%s%s}", pad, name, hclBody(e.(map[string]interface{}), indent+2), pad))
+				}
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s%s = %s", pad, name, hclValue(v)))
+		default:
+			lines = append(lines, fmt.Sprintf("%s%s = %s", pad, name, hclValue(v)))
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// hclValue formats a scalar or a list of scalars as an HCL expression
+func hclValue(in interface{}) string {
+	switch v := in.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case []interface{}:
+		elems := make([]string, 0, len(v))
+		for _, e := range v {
+			elems = append(elems, hclValue(e))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	default:
+		return strconv.Quote(fmt.Sprint(v))
+	}
+}
+
+func isListOfMaps(in []interface{}) bool {
+	if len(in) == 0 {
+		return false
+	}
+	for _, e := range in {
+		if _, ok := e.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return true
+}
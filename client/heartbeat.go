@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// heartbeat periodically reports the status of the client to the API
+// until the client is shut down.
+func (c *Client) heartbeat() {
+
+	timer := time.NewTimer(defaultFirstHeartbeatDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-c.shutdownCh:
+			return
+		case <-timer.C:
+		}
+
+		if err := c.sendHeartbeat(); err != nil {
+			c.logger.Debugf("error sending heartbeat: %v", err)
+		}
+
+		timer.Reset(randomDuration(c.config.HeartbeatInterval, 1*time.Second))
+	}
+}
+
+func (c *Client) sendHeartbeat() error {
+
+	req := &structs.DeviceHeartbeatRequest{
+		OrganizationID: c.config.OrganizationID,
+		ProjectID:      c.config.ProjectID,
+		BatchID:        c.config.DeviceBatchID,
+		DeviceID:       c.config.DeviceID,
+		DeviceRemoteID: c.config.DeviceRemoteID,
+		Heartbeat:      c.heartbeatPayload(),
+	}
+
+	req.QueryOptions.AuthToken = c.Device().Token
+
+	_, err := c.api.Devices().Heartbeat(context.TODO(), req)
+
+	return err
+}
+
+// heartbeatPayload returns the status reported to the API in heartbeats
+func (c *Client) heartbeatPayload() *structs.DeviceHeartbeat {
+
+	c.deviceLock.Lock()
+	status := c.device.Status
+	c.deviceLock.Unlock()
+
+	return &structs.DeviceHeartbeat{
+		Status:           status,
+		Modules:          c.ModuleStatuses(),
+		Hooks:            c.HookStatuses(),
+		ContainerRuntime: c.ContainerRuntimeStatus(),
+		Facts:            c.Facts(),
+		Meta:             c.Meta(),
+		Update:           c.AgentUpdateStatus(),
+		Maintenance:      c.MaintenanceStatus(),
+		Timestamp:        time.Now(),
+	}
+}
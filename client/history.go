@@ -0,0 +1,324 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	boltdb "github.com/seashell/agent/client/state/boltdb"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// defaultStateLockTimeout is how long commands operating on the client
+	// state wait for the state DB lock, which is held while the agent is running.
+	defaultStateLockTimeout = 1 * time.Second
+)
+
+// recordRemoteConfiguration stores the configuration received from
+// the API in the history, in case it differs from the latest one.
+func (c *Client) recordRemoteConfiguration(tx state.Transaction, resp *structs.DeviceSyncResponse) {
+
+	latest, err := c.latestConfigurationVersion(tx, structs.ConfigurationVersionRemote)
+	if err != nil {
+		c.logger.Warnf("could not read remote configuration history: %v", err)
+		return
+	}
+
+	if latest != nil {
+		previous := &structs.Configuration{}
+		if err := json.Unmarshal(latest.Configuration, previous); err == nil && previous.Hash() == resp.Configuration.Hash() {
+			return
+		}
+	}
+
+	c.recordConfigurationVersion(tx, structs.ConfigurationVersionRemote, resp.Configuration, resp.Meta)
+}
+
+// recordConfigurationVersion stores a configuration applied
+// to a module in the history, so that it can be rolled back to.
+func (c *Client) recordConfigurationVersion(tx state.Transaction, module string, config interface{}, meta map[string]string) {
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		c.logger.Warnf("could not encode %s configuration: %v", module, err)
+		return
+	}
+
+	v := &structs.ConfigurationVersion{
+		Module:        module,
+		Configuration: encoded,
+		Meta:          meta,
+		Timestamp:     time.Now(),
+	}
+
+	if err := tx.AddConfigurationVersion(v, c.config.HistorySize); err != nil {
+		c.logger.Warnf("could not record %s configuration version: %v", module, err)
+	}
+}
+
+func (c *Client) latestConfigurationVersion(tx state.Transaction, module string) (*structs.ConfigurationVersion, error) {
+
+	versions, err := tx.ConfigurationVersions(module)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, nil
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// pinnedConfiguration decodes the configuration version to which a module
+// is pinned into out, returning true if the module is pinned. Pins are
+// released as soon as the remote configuration changes.
+func (c *Client) pinnedConfiguration(tx state.Transaction, module string, remote *structs.Configuration, out interface{}) bool {
+
+	pin, err := tx.ConfigurationPin(module)
+	if err != nil {
+		c.logger.Warnf("could not read %s configuration pin: %v", module, err)
+		return false
+	}
+
+	if pin == nil {
+		return false
+	}
+
+	if pin.RemoteHash != remote.Hash() {
+		c.emitEvent(structs.EventTypeInfo, module, "remote configuration changed, releasing pin on version %d", pin.Version)
+		if err := tx.DeleteConfigurationPin(module); err != nil {
+			c.logger.Warnf("could not delete %s configuration pin: %v", module, err)
+		}
+		return false
+	}
+
+	if !c.decodePinnedConfiguration(tx, pin, out) {
+		return false
+	}
+
+	c.logger.Debugf("%s configuration pinned to version %d", module, pin.Version)
+
+	return true
+}
+
+// decodePinnedConfiguration decodes the configuration version
+// to which a module is pinned into out, returning true on success
+func (c *Client) decodePinnedConfiguration(tx state.Transaction, pin *structs.ConfigurationPin, out interface{}) bool {
+
+	v, err := tx.ConfigurationVersion(pin.Module, pin.Version)
+	if err != nil {
+		c.logger.Warnf("could not read pinned %s configuration version %d: %v", pin.Module, pin.Version, err)
+		return false
+	}
+
+	if err := json.Unmarshal(v.Configuration, out); err != nil {
+		c.logger.Warnf("could not decode pinned %s configuration version %d: %v", pin.Module, pin.Version, err)
+		return false
+	}
+
+	return true
+}
+
+// applyConfigurationVersion renders a configuration version from the
+// history and persists it as the current configuration of its module.
+func (c *Client) applyConfigurationVersion(tx state.Transaction, v *structs.ConfigurationVersion) error {
+
+	switch v.Module {
+	case "drago":
+		current, err := tx.DragoConfiguration()
+		if err != nil {
+			return err
+		}
+		desired := &structs.DragoConfiguration{}
+		if err := json.Unmarshal(v.Configuration, desired); err != nil {
+			return err
+		}
+		if err := c.renderModuleFile(tx, v.Module, dragoTemplateString, desired, nil); err != nil {
+			return err
+		}
+		if err := tx.SetDragoConfiguration(desired); err != nil {
+			return err
+		}
+		c.recordConfigurationChange(tx, v.Module, current, desired)
+		c.moduleChanged(v.Module)
+
+	case "nomad":
+		current, err := tx.NomadConfiguration()
+		if err != nil {
+			return err
+		}
+		desired := &structs.NomadConfiguration{}
+		if err := json.Unmarshal(v.Configuration, desired); err != nil {
+			return err
+		}
+		if err := c.renderModuleFile(tx, v.Module, nomadTemplateString, desired, nil); err != nil {
+			return err
+		}
+		if err := tx.SetNomadConfiguration(desired); err != nil {
+			return err
+		}
+		c.recordConfigurationChange(tx, v.Module, current, desired)
+		c.moduleChanged(v.Module)
+
+	case "consul":
+		current, err := tx.ConsulConfiguration()
+		if err != nil {
+			return err
+		}
+		desired := &structs.ConsulConfiguration{}
+		if err := json.Unmarshal(v.Configuration, desired); err != nil {
+			return err
+		}
+		if err := c.renderModuleFile(tx, v.Module, consulTemplateString, desired, c.consulTLSFileContents(desired)); err != nil {
+			return err
+		}
+		if err := tx.SetConsulConfiguration(desired); err != nil {
+			return err
+		}
+		c.recordConfigurationChange(tx, v.Module, current, desired)
+		c.moduleChanged(v.Module)
+
+	case "files":
+		current, err := tx.FilesConfiguration()
+		if err != nil {
+			return err
+		}
+		desired := &structs.FilesConfiguration{}
+		if err := json.Unmarshal(v.Configuration, desired); err != nil {
+			return err
+		}
+		if err := c.applyManagedFiles(current, desired); err != nil {
+			return err
+		}
+		if err := tx.SetFilesConfiguration(desired); err != nil {
+			return err
+		}
+		c.recordConfigurationChange(tx, v.Module, current, desired)
+		c.moduleChanged(v.Module)
+
+	case "runtime":
+		current, err := tx.ContainerRuntimeConfiguration()
+		if err != nil {
+			return err
+		}
+		desired := &structs.ContainerRuntimeConfiguration{}
+		if err := json.Unmarshal(v.Configuration, desired); err != nil {
+			return err
+		}
+		if err := c.applyContainerRuntimeConfiguration(desired, current.Hash() != desired.Hash()); err != nil {
+			return err
+		}
+		if err := tx.SetContainerRuntimeConfiguration(desired); err != nil {
+			return err
+		}
+		c.recordConfigurationChange(tx, v.Module, current, desired)
+		c.moduleChanged(v.Module)
+
+	default:
+		return fmt.Errorf("module %q cannot be rolled back", v.Module)
+	}
+
+	return nil
+}
+
+// openState opens the client state for commands which run while the
+// agent is stopped, failing if the state is locked by a running agent.
+func (c *Client) openState() (*boltdb.StateRepository, error) {
+
+	repo, err := boltdb.OpenStateRepository(path.Join(c.config.StateDir, "client.state"), defaultStateLockTimeout, c.logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not open client state (is the agent running?): %w", err)
+	}
+
+	c.state = repo
+
+	return repo, nil
+}
+
+// ConfigurationHistory returns the configuration versions stored in the
+// client state for the given modules, from the oldest to the newest.
+func ConfigurationHistory(config *Config, modules ...string) ([]*structs.ConfigurationVersion, error) {
+
+	c := newClient(config)
+
+	repo, err := c.openState()
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	out := []*structs.ConfigurationVersion{}
+
+	for _, module := range modules {
+		versions, err := repo.ConfigurationVersions(module)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, versions...)
+	}
+
+	return out, nil
+}
+
+// Rollback re-renders a previously applied configuration version of a
+// module and pins the module to it until the remote configuration changes.
+func Rollback(config *Config, module string, version uint64) error {
+
+	c := newClient(config)
+
+	if err := c.setupOutputDir(); err != nil {
+		return fmt.Errorf("error setting up output dir: %v", err)
+	}
+
+	repo, err := c.openState()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	v, err := repo.ConfigurationVersion(module, version)
+	if err != nil {
+		return fmt.Errorf("could not find version %d of %s configuration: %v", version, module, err)
+	}
+
+	pin := &structs.ConfigurationPin{
+		Module:    module,
+		Version:   version,
+		Timestamp: time.Now(),
+	}
+
+	// The configuration version and its pin are persisted atomically
+	err = c.updateState(func(tx state.Transaction) error {
+
+		// Pin against the latest remote configuration, so that the pin
+		// is released as soon as a different one is received.
+		latest, err := c.latestConfigurationVersion(tx, structs.ConfigurationVersionRemote)
+		if err != nil {
+			return err
+		}
+		if latest != nil {
+			remote := &structs.Configuration{}
+			if err := json.Unmarshal(latest.Configuration, remote); err != nil {
+				return err
+			}
+			pin.RemoteHash = remote.Hash()
+		}
+
+		if err := c.applyConfigurationVersion(tx, v); err != nil {
+			return fmt.Errorf("could not apply version %d of %s configuration: %v", version, module, err)
+		}
+
+		return tx.SetConfigurationPin(pin)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.runQueuedHooks()
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultHookTimeout = 60 * time.Second
+
+	// hookOutputLimit is the maximum number of bytes
+	// of hook output kept in the event log.
+	hookOutputLimit = 1024
+
+	// hookSchedulerInterval is the resolution of periodic hooks
+	hookSchedulerInterval = 1 * time.Second
+)
+
+var envNameRegexp = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// hookRunner keeps track of the hooks received from the API,
+// of the schedule of periodic hooks and of the result of each run.
+type hookRunner struct {
+	lock sync.Mutex
+
+	// remote contains the hooks received from the API, if allowed
+	remote []*structs.Hook
+
+	// remoteStarted indicates whether remote on_start
+	// hooks have already been queued
+	remoteStarted bool
+
+	// starting contains the remote on_start hooks to be run
+	starting []*structs.Hook
+
+	// labels contains the latest device labels,
+	// which are injected in the environment of hooks
+	labels map[string]string
+
+	// changed contains the modules whose output changed within the
+	// current transaction of the client state, and pending those whose
+	// on_change hooks are to be run, as their transaction was committed
+	changed []string
+	pending []string
+
+	statuses map[string]*structs.HookStatus
+	nextRun  map[string]time.Time
+}
+
+func newHookRunner() *hookRunner {
+	return &hookRunner{
+		labels:   map[string]string{},
+		statuses: map[string]*structs.HookStatus{},
+		nextRun:  map[string]time.Time{},
+	}
+}
+
+// setLabels replaces the device labels injected into hooks
+func (r *hookRunner) setLabels(labels map[string]string) {
+	r.lock.Lock()
+	r.labels = labels
+	r.lock.Unlock()
+}
+
+// HookStatuses returns the result of the latest run of each hook
+func (c *Client) HookStatuses() []*structs.HookStatus {
+
+	c.hooks.lock.Lock()
+	defer c.hooks.lock.Unlock()
+
+	out := make([]*structs.HookStatus, 0, len(c.hooks.statuses))
+	for _, s := range c.hooks.statuses {
+		status := *s
+		out = append(out, &status)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	return out
+}
+
+// allHooks returns the local hooks, followed by the remote ones
+func (c *Client) allHooks() []*structs.Hook {
+
+	c.hooks.lock.Lock()
+	defer c.hooks.lock.Unlock()
+
+	out := []*structs.Hook{}
+	out = append(out, c.config.Hooks...)
+	out = append(out, c.hooks.remote...)
+
+	return out
+}
+
+// updateRemoteHooks replaces the hooks received from the API, provided
+// that the local configuration allows for them. Remote on_start hooks are
+// queued as soon as the first configuration containing them is received,
+// and run by runQueuedHooks.
+func (c *Client) updateRemoteHooks(config *structs.Configuration) {
+
+	local := map[string]struct{}{}
+	for _, h := range c.config.Hooks {
+		local[h.Name] = struct{}{}
+	}
+
+	remote := []*structs.Hook{}
+
+	if len(config.Hooks) > 0 && !c.config.AllowRemoteHooks {
+		c.logger.Debugf("ignoring %d remote hooks, as they are not allowed by the client configuration", len(config.Hooks))
+	} else {
+		for _, h := range config.Hooks {
+			if err := h.Validate(); err != nil {
+				c.emitEvent(structs.EventTypeWarning, "hooks", "ignoring invalid remote hook: %v", err)
+				continue
+			}
+			if _, ok := local[h.Name]; ok {
+				c.emitEvent(structs.EventTypeWarning, "hooks", "ignoring remote hook %s, as a local hook with the same name exists", h.Name)
+				continue
+			}
+			hook := *h
+			hook.Source = structs.HookSourceRemote
+			remote = append(remote, &hook)
+		}
+	}
+
+	c.hooks.lock.Lock()
+	changed := !reflect.DeepEqual(c.hooks.remote, remote)
+	c.hooks.remote = remote
+	if !c.hooks.remoteStarted {
+		for _, h := range remote {
+			if h.Trigger == structs.HookTriggerOnStart {
+				c.hooks.starting = append(c.hooks.starting, h)
+			}
+		}
+	}
+	c.hooks.remoteStarted = true
+	c.hooks.lock.Unlock()
+
+	if changed && len(remote) > 0 {
+		c.emitEvent(structs.EventTypeInfo, "hooks", "received %d remote hooks", len(remote))
+	}
+}
+
+// runHooks runs the hooks with the given trigger, in order. For on_change
+// hooks, only those of the given module are run.
+func (c *Client) runHooks(trigger string, module string) {
+	for _, h := range c.allHooks() {
+		if h.Trigger != trigger {
+			continue
+		}
+		if trigger == structs.HookTriggerOnChange && h.Module != module {
+			continue
+		}
+		c.runHook(h, module)
+	}
+}
+
+// moduleChanged records that the output of a module changed within
+// the current transaction of the client state
+func (c *Client) moduleChanged(module string) {
+	c.hooks.lock.Lock()
+	c.hooks.changed = appendModule(c.hooks.changed, module)
+	c.hooks.lock.Unlock()
+}
+
+// updateState runs fn within a transaction of the client state. The
+// on_change hooks of the modules changed by fn are queued once the
+// transaction is committed, and discarded in case it is rolled back,
+// since the changes are then rendered again on the next reconciliation.
+// Queued hooks are run by runQueuedHooks.
+func (c *Client) updateState(fn func(tx state.Transaction) error) error {
+
+	err := c.state.Update(fn)
+
+	c.hooks.lock.Lock()
+	if err == nil {
+		for _, m := range c.hooks.changed {
+			c.hooks.pending = appendModule(c.hooks.pending, m)
+		}
+	}
+	c.hooks.changed = nil
+	c.hooks.lock.Unlock()
+
+	return err
+}
+
+// runQueuedHooks runs the remote on_start hooks, followed by the on_change
+// hooks queued by committed transactions. It must be called without holding
+// the shutdown lock, so that hooks, which can run up to their timeout, do
+// not delay the shutdown of the client.
+func (c *Client) runQueuedHooks() {
+
+	c.hooks.lock.Lock()
+	starting := c.hooks.starting
+	c.hooks.starting = nil
+	modules := c.hooks.pending
+	c.hooks.pending = nil
+	c.hooks.lock.Unlock()
+
+	for _, h := range starting {
+		c.runHook(h, "")
+	}
+
+	for _, m := range modules {
+		c.runHooks(structs.HookTriggerOnChange, m)
+	}
+}
+
+func appendModule(modules []string, module string) []string {
+	for _, m := range modules {
+		if m == module {
+			return modules
+		}
+	}
+	return append(modules, module)
+}
+
+// runLocalStartHooks runs the on_start hooks of the local configuration
+func (c *Client) runLocalStartHooks() {
+	for _, h := range c.config.Hooks {
+		if h.Trigger == structs.HookTriggerOnStart {
+			c.runHook(h, "")
+		}
+	}
+}
+
+// runPeriodicHooks runs periodic hooks at their intervals until the client
+// is shut down. The first run of each hook happens one interval after the
+// hook is first seen.
+func (c *Client) runPeriodicHooks() {
+
+	ticker := time.NewTicker(hookSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.shutdownCh:
+			return
+		case now := <-ticker.C:
+			for _, h := range c.allHooks() {
+
+				if h.Trigger != structs.HookTriggerPeriodic {
+					continue
+				}
+
+				interval, err := time.ParseDuration(h.Interval)
+				if err != nil {
+					continue
+				}
+
+				c.hooks.lock.Lock()
+				next, ok := c.hooks.nextRun[h.Name]
+				if !ok || now.After(next) {
+					c.hooks.nextRun[h.Name] = now.Add(interval)
+				}
+				c.hooks.lock.Unlock()
+
+				if ok && now.After(next) {
+					c.runHook(h, "")
+				}
+			}
+		}
+	}
+}
+
+// runHook runs a hook through the shell, capturing its output into the
+// event log and keeping track of its exit status.
+func (c *Client) runHook(h *structs.Hook, module string) {
+
+	timeout := defaultHookTimeout
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err == nil {
+			timeout = d
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(), c.hookEnv(h, module)...)
+
+	c.logger.Debugf("running %s hook %s", h.Trigger, h.Name)
+
+	start := time.Now()
+	out, err := runCommandWithOutput(cmd)
+
+	status := &structs.HookStatus{
+		Name:     h.Name,
+		Source:   h.Source,
+		Trigger:  h.Trigger,
+		LastRun:  start,
+		Duration: time.Since(start),
+	}
+
+	output := strings.TrimSpace(string(out))
+	if len(output) > hookOutputLimit {
+		output = output[:hookOutputLimit] + "..."
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		status.ExitCode = -1
+		status.Error = fmt.Sprintf("timed out after %s", timeout)
+	case err != nil:
+		status.ExitCode = -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			status.ExitCode = exitErr.ExitCode()
+		}
+		status.Error = err.Error()
+	}
+
+	if status.Error != "" {
+		c.emitEvent(structs.EventTypeWarning, "hooks", "hook %s failed: %s: %s", h.Name, status.Error, output)
+	} else {
+		c.emitEvent(structs.EventTypeInfo, "hooks", "hook %s succeeded: %s", h.Name, output)
+	}
+
+	c.hooks.lock.Lock()
+	c.hooks.statuses[h.Name] = status
+	c.hooks.lock.Unlock()
+}
+
+// runCommandWithOutput runs a command, returning its combined output. Output
+// is written to a temporary file rather than to a pipe, so that commands
+// are not waited upon past their timeout by processes they spawned, which
+// would otherwise keep the pipe open.
+func runCommandWithOutput(cmd *exec.Cmd) ([]byte, error) {
+	return runCommandToFile(cmd, true)
+}
+
+// runCommandWithStdout runs a command like runCommandWithOutput,
+// returning its standard output only and discarding its standard error.
+func runCommandWithStdout(cmd *exec.Cmd) ([]byte, error) {
+	return runCommandToFile(cmd, false)
+}
+
+func runCommandToFile(cmd *exec.Cmd, combined bool) ([]byte, error) {
+
+	f, err := ioutil.TempFile("", "seashell-hook-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	cmd.Stdout = f
+	if combined {
+		cmd.Stderr = f
+	}
+
+	runErr := cmd.Run()
+
+	out, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return out, runErr
+}
+
+// hookEnv returns the environment variables injected into hooks, i.e. the
+// device identifiers, the client metadata as SEASHELL_META_<KEY>, the device
+// labels as SEASHELL_LABEL_<KEY>, and the variables defined by the hook.
+func (c *Client) hookEnv(h *structs.Hook, module string) []string {
+
+	env := []string{
+		"SEASHELL_HOOK=" + h.Name,
+		"SEASHELL_HOOK_TRIGGER=" + h.Trigger,
+		"SEASHELL_MODULE=" + module,
+		"SEASHELL_DEVICE_ID=" + c.config.DeviceID,
+		"SEASHELL_DEVICE_REMOTE_ID=" + c.config.DeviceRemoteID,
+	}
+
+	for k, v := range c.Meta() {
+		env = append(env, "SEASHELL_META_"+envName(k)+"="+v)
+	}
+
+	c.hooks.lock.Lock()
+	for k, v := range c.hooks.labels {
+		env = append(env, "SEASHELL_LABEL_"+envName(k)+"="+v)
+	}
+	c.hooks.lock.Unlock()
+
+	for k, v := range h.Env {
+		env = append(env, k+"="+v)
+	}
+
+	return env
+}
+
+// envName converts a key into an environment variable name, e.g. "rack-id" into "RACK_ID"
+func envName(k string) string {
+	return envNameRegexp.ReplaceAllString(strings.ToUpper(k), "_")
+}
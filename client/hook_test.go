@@ -0,0 +1,47 @@
+package client
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+func TestRemoteStartHooks_Queued(t *testing.T) {
+
+	c := testClient(t, &Config{AllowRemoteHooks: true})
+
+	started := filepath.Join(t.TempDir(), "started")
+
+	config := &structs.Configuration{
+		Hooks: []*structs.Hook{
+			{Name: "start", Trigger: structs.HookTriggerOnStart, Command: "echo >> " + started},
+		},
+	}
+
+	// Remote on_start hooks are not run while reconciling,
+	// as the shutdown lock is held meanwhile
+	c.updateRemoteHooks(config)
+	if exists(started) {
+		t.Fatal("on_start hook run while updating remote hooks")
+	}
+
+	c.runQueuedHooks()
+	if !exists(started) {
+		t.Fatal("on_start hook not run")
+	}
+
+	// and they are only run once
+	c.updateRemoteHooks(config)
+	c.runQueuedHooks()
+
+	out, err := ioutil.ReadFile(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(out), "\n"); runs != 1 {
+		t.Fatalf("on_start hook run %d times", runs)
+	}
+}
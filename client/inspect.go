@@ -0,0 +1,368 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	boltdb "github.com/seashell/agent/client/state/boltdb"
+	diff "github.com/seashell/agent/pkg/diff"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// IsStateLocked returns true if err was caused by the client
+// state being locked, e.g. because the agent is running
+func IsStateLocked(err error) bool {
+	return errors.Is(err, boltdb.ErrLocked)
+}
+
+// StoredConfigurations returns the configuration stored in the client
+// state for a single module, or for all of them if module is empty,
+// keyed by module name and with their secrets redacted.
+func (c *Client) StoredConfigurations(module string) (map[string]interface{}, error) {
+
+	modules, err := selectModules(module)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]interface{}{}
+
+	for _, m := range modules {
+		config, err := moduleConfiguration(c.state, m)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			out[m] = diff.Redact(config)
+		}
+	}
+
+	return out, nil
+}
+
+// ExportState returns the client state as a versioned document
+func (c *Client) ExportState() (*structs.StateExport, error) {
+
+	e := &structs.StateExport{
+		Version:        structs.StateExportVersion,
+		ExportedAt:     time.Now(),
+		Configurations: map[string]json.RawMessage{},
+		History:        map[string][]*structs.ConfigurationVersion{},
+	}
+
+	for _, m := range ModuleNames() {
+		config, err := moduleConfiguration(c.state, m)
+		if err != nil {
+			return nil, err
+		}
+		if config != nil {
+			encoded, err := json.Marshal(config)
+			if err != nil {
+				return nil, err
+			}
+			e.Configurations[m] = encoded
+		}
+	}
+
+	for _, m := range append([]string{structs.ConfigurationVersionRemote}, ModuleNames()...) {
+		versions, err := c.state.ConfigurationVersions(m)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) > 0 {
+			e.History[m] = versions
+		}
+	}
+
+	override, err := c.state.ConfigurationOverride()
+	if err != nil {
+		return nil, err
+	}
+	e.Override = override
+
+	return e, nil
+}
+
+// ImportState replaces the configurations and the override stored in the
+// client state with those of an exported document, and appends its history
+// to the one in the client state. Modules are pinned to none of their
+// versions, and are rendered again in case their configuration changed.
+func (c *Client) ImportState(e *structs.StateExport) error {
+
+	if e.Version != structs.StateExportVersion {
+		return structs.NewInvalidInputError(fmt.Sprintf("unsupported state export version %d, expected %d", e.Version, structs.StateExportVersion))
+	}
+
+	for m := range e.Configurations {
+		if _, err := selectModules(m); err != nil {
+			return err
+		}
+	}
+
+	if e.Override != nil {
+		if err := e.Override.Validate(); err != nil {
+			return err
+		}
+	}
+
+	err := c.state.Update(func(tx state.Transaction) error {
+
+		for _, m := range ModuleNames() {
+			if err := tx.DeleteConfigurationPin(m); err != nil {
+				return err
+			}
+			encoded, ok := e.Configurations[m]
+			if !ok {
+				if err := tx.DeleteConfiguration(m); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := setModuleConfiguration(tx, m, encoded); err != nil {
+				return fmt.Errorf("invalid %s configuration: %v", m, err)
+			}
+		}
+
+		for m, versions := range e.History {
+
+			// Versions already in the history, e.g. when importing a
+			// document exported from the same client, are skipped
+			existing, err := tx.ConfigurationVersions(m)
+			if err != nil {
+				return err
+			}
+
+			for _, v := range versions {
+				if containsVersion(existing, v) {
+					continue
+				}
+				v.Module = m
+				if err := tx.AddConfigurationVersion(v, c.config.HistorySize); err != nil {
+					return err
+				}
+			}
+		}
+
+		if e.Override == nil {
+			return tx.DeleteConfigurationOverride()
+		}
+
+		return tx.SetConfigurationOverride(e.Override)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "state", "client state imported from export taken at %s", e.ExportedAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// ResetState deletes the configuration stored for a single module, or for
+// all of them if module is empty, so that they are rendered again on the
+// next reconciliation.
+func (c *Client) ResetState(module string) error {
+
+	modules, err := selectModules(module)
+	if err != nil {
+		return err
+	}
+
+	err = c.state.Update(func(tx state.Transaction) error {
+		for _, m := range modules {
+			if err := tx.DeleteConfiguration(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range modules {
+		c.emitEvent(structs.EventTypeInfo, m, "stored configuration reset, it will be rendered again")
+	}
+
+	return nil
+}
+
+// StoredConfigurations returns the configurations stored in the client
+// state, which is read directly. See (*Client).StoredConfigurations.
+func StoredConfigurations(config *Config, module string) (map[string]interface{}, error) {
+
+	c := newClient(config)
+
+	repo, err := c.openState()
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	return c.StoredConfigurations(module)
+}
+
+// ExportState exports the client state, which is read directly
+func ExportState(config *Config) (*structs.StateExport, error) {
+
+	c := newClient(config)
+
+	repo, err := c.openState()
+	if err != nil {
+		return nil, err
+	}
+	defer repo.Close()
+
+	return c.ExportState()
+}
+
+// ImportState imports a document into the client state, which
+// is modified directly. See (*Client).ImportState.
+func ImportState(config *Config, e *structs.StateExport) error {
+
+	c := newClient(config)
+
+	repo, err := c.openState()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return c.ImportState(e)
+}
+
+// ResetState resets the configuration stored for one or all modules
+// in the client state, which is modified directly.
+func ResetState(config *Config, module string) error {
+
+	c := newClient(config)
+
+	repo, err := c.openState()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return c.ResetState(module)
+}
+
+// containsVersion returns true if versions contains a version with the
+// same timestamp and configuration as v, regardless of its formatting
+func containsVersion(versions []*structs.ConfigurationVersion, v *structs.ConfigurationVersion) bool {
+
+	compact := func(in json.RawMessage) string {
+		out := &bytes.Buffer{}
+		if err := json.Compact(out, in); err != nil {
+			return string(in)
+		}
+		return out.String()
+	}
+
+	for _, existing := range versions {
+		if existing.Timestamp.Equal(v.Timestamp) && compact(existing.Configuration) == compact(v.Configuration) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectModules returns the given module, or all
+// modules if empty, failing if it is unknown
+func selectModules(module string) ([]string, error) {
+
+	if module == "" {
+		return ModuleNames(), nil
+	}
+
+	for _, m := range ModuleNames() {
+		if m == module {
+			return []string{m}, nil
+		}
+	}
+
+	return nil, structs.NewInvalidInputError(fmt.Sprintf("unknown module %q", module))
+}
+
+// moduleConfiguration returns the configuration stored
+// for a module, or nil in case there is none
+func moduleConfiguration(tx state.Transaction, module string) (interface{}, error) {
+
+	var config interface{}
+	var err error
+
+	switch module {
+	case "drago":
+		var c *structs.DragoConfiguration
+		if c, err = tx.DragoConfiguration(); c != nil {
+			config = c
+		}
+	case "nomad":
+		var c *structs.NomadConfiguration
+		if c, err = tx.NomadConfiguration(); c != nil {
+			config = c
+		}
+	case "consul":
+		var c *structs.ConsulConfiguration
+		if c, err = tx.ConsulConfiguration(); c != nil {
+			config = c
+		}
+	case "files":
+		var c *structs.FilesConfiguration
+		if c, err = tx.FilesConfiguration(); c != nil {
+			config = c
+		}
+	case "runtime":
+		var c *structs.ContainerRuntimeConfiguration
+		if c, err = tx.ContainerRuntimeConfiguration(); c != nil {
+			config = c
+		}
+	default:
+		return nil, fmt.Errorf("unknown module %q", module)
+	}
+
+	return config, err
+}
+
+// setModuleConfiguration decodes and stores the configuration of a module
+func setModuleConfiguration(tx state.Transaction, module string, encoded json.RawMessage) error {
+
+	switch module {
+	case "drago":
+		c := &structs.DragoConfiguration{}
+		if err := json.Unmarshal(encoded, c); err != nil {
+			return err
+		}
+		return tx.SetDragoConfiguration(c)
+	case "nomad":
+		c := &structs.NomadConfiguration{}
+		if err := json.Unmarshal(encoded, c); err != nil {
+			return err
+		}
+		return tx.SetNomadConfiguration(c)
+	case "consul":
+		c := &structs.ConsulConfiguration{}
+		if err := json.Unmarshal(encoded, c); err != nil {
+			return err
+		}
+		return tx.SetConsulConfiguration(c)
+	case "files":
+		c := &structs.FilesConfiguration{}
+		if err := json.Unmarshal(encoded, c); err != nil {
+			return err
+		}
+		return tx.SetFilesConfiguration(c)
+	case "runtime":
+		c := &structs.ContainerRuntimeConfiguration{}
+		if err := json.Unmarshal(encoded, c); err != nil {
+			return err
+		}
+		return tx.SetContainerRuntimeConfiguration(c)
+	}
+
+	return fmt.Errorf("unknown module %q", module)
+}
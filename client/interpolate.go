@@ -0,0 +1,166 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// interpolationFactPrefix prefixes references to device facts,
+	// e.g. ${fact.hostname} or ${fact.modem.imei}
+	interpolationFactPrefix = "fact."
+
+	// interpolationMetaPrefix prefixes references to the
+	// client metadata, e.g. ${meta.rack}
+	interpolationMetaPrefix = "meta."
+)
+
+// interpolationRegexp matches references such as ${fact.hostname}, as well
+// as escaped ones such as $${fact.hostname}, which are output verbatim
+// without their leading $.
+var interpolationRegexp = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// interpolate replaces the references in s with their values, which are
+// looked up by resolve. It fails if any of the references is undefined.
+func interpolate(s string, resolve func(ref string) (string, bool)) (string, error) {
+
+	undefined := []string{}
+
+	out := interpolationRegexp.ReplaceAllStringFunc(s, func(match string) string {
+
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		ref := strings.TrimSpace(interpolationRegexp.FindStringSubmatch(match)[1])
+
+		v, ok := resolve(ref)
+		if !ok {
+			undefined = append(undefined, match)
+			return match
+		}
+
+		return v
+	})
+
+	switch len(undefined) {
+	case 0:
+	case 1:
+		return "", fmt.Errorf("undefined reference %s", undefined[0])
+	default:
+		return "", fmt.Errorf("undefined references %s", strings.Join(undefined, ", "))
+	}
+
+	return out, nil
+}
+
+// interpolateMap interpolates the values of a map, failing with
+// all of its undefined references, reported by key.
+func interpolateMap(in map[string]string, kind string, resolve func(ref string) (string, bool)) (map[string]string, error) {
+
+	if in == nil {
+		return nil, nil
+	}
+
+	out := make(map[string]string, len(in))
+	errs := []string{}
+
+	for k, v := range in {
+		interpolated, err := interpolate(v, resolve)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %q: %v", kind, k, err))
+			out[k] = v
+			continue
+		}
+		out[k] = interpolated
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return out, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return out, nil
+}
+
+// factResolver resolves references to the given facts. If meta is
+// not nil, references to the client metadata are resolved too.
+func factResolver(facts map[string]string, meta map[string]string) func(ref string) (string, bool) {
+	return func(ref string) (string, bool) {
+		switch {
+		case strings.HasPrefix(ref, interpolationFactPrefix):
+			v, ok := facts[strings.TrimPrefix(ref, interpolationFactPrefix)]
+			return v, ok
+		case meta != nil && strings.HasPrefix(ref, interpolationMetaPrefix):
+			v, ok := meta[strings.TrimPrefix(ref, interpolationMetaPrefix)]
+			return v, ok
+		}
+		return "", false
+	}
+}
+
+// interpolatedMeta returns the client metadata, i.e. the custom facts
+// overlaid with the meta defined in the local configuration, whose
+// values can reference device facts. Values with undefined references
+// are returned verbatim, along with an error.
+func (c *Client) interpolatedMeta(facts *structs.DeviceFacts) (map[string]string, error) {
+
+	out := map[string]string{}
+
+	for k, v := range facts.Custom {
+		out[k] = v
+	}
+
+	local, err := interpolateMap(c.config.Meta, "meta", factResolver(facts.Map(), nil))
+
+	for k, v := range local {
+		out[k] = v
+	}
+
+	return out, err
+}
+
+// interpolatedConfiguration returns a copy of config whose labels reference
+// device facts and client metadata, e.g. rack = "${fact.hostname}", are
+// replaced with their values. It fails if any of the labels, or of the
+// values of the local meta, contains undefined references, in which case
+// the returned copy only contains the labels which could be interpolated.
+func (c *Client) interpolatedConfiguration(config *structs.Configuration) (*structs.Configuration, error) {
+
+	facts := c.Facts()
+
+	meta, metaErr := c.interpolatedMeta(facts)
+	if metaErr != nil {
+		// Values of the local meta with undefined references are not
+		// resolved, so that labels referencing them are left out
+		for k, v := range c.config.Meta {
+			if _, err := interpolate(v, factResolver(facts.Map(), nil)); err != nil {
+				delete(meta, k)
+			}
+		}
+	}
+
+	resolve := factResolver(facts.Map(), meta)
+
+	labels, err := interpolateMap(config.Labels, "label", resolve)
+	if err != nil {
+		for k, v := range config.Labels {
+			if _, err := interpolate(v, resolve); err != nil {
+				delete(labels, k)
+			}
+		}
+	}
+
+	out := *config
+	out.Labels = labels
+
+	if metaErr != nil {
+		return &out, metaErr
+	}
+
+	return &out, err
+}
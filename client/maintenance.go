@@ -0,0 +1,298 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	cron "github.com/seashell/agent/pkg/cron"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// MaintenanceWindow is a recurring window during which
+// configuration changes received from the API are applied
+type MaintenanceWindow struct {
+
+	// Schedule is when the window opens
+	Schedule *cron.Schedule
+
+	// Duration is how long the window stays open
+	Duration time.Duration
+
+	// Location is the time zone in which the schedule is evaluated
+	Location *time.Location
+}
+
+// Open returns true if the window is open at t
+func (w *MaintenanceWindow) Open(t time.Time) bool {
+
+	t = w.in(t).Truncate(time.Minute)
+
+	for start := t; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.Schedule.Matches(start) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns t if the window is open at t, or the time at which it next
+// opens otherwise, which is the zero time if it does not open anymore
+func (w *MaintenanceWindow) Next(t time.Time) time.Time {
+
+	if w.Open(t) {
+		return t
+	}
+
+	return w.Schedule.Next(w.in(t))
+}
+
+func (w *MaintenanceWindow) in(t time.Time) time.Time {
+	if w.Location == nil {
+		return t.In(SystemLocation())
+	}
+	return t.In(w.Location)
+}
+
+// SystemLocation returns the time zone of the system, read from
+// /etc/localtime, since the agent runs with TZ set to UTC. It
+// defaults to UTC in case the time zone cannot be read.
+func SystemLocation() *time.Location {
+
+	data, err := ioutil.ReadFile("/etc/localtime")
+	if err != nil {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocationFromTZData("Local", data)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// inMaintenanceWindow returns true if configuration changes can be applied
+// at t, i.e. if no maintenance windows are configured, or if one is open
+func (c *Client) inMaintenanceWindow(t time.Time) bool {
+
+	if len(c.config.MaintenanceWindows) == 0 {
+		return true
+	}
+
+	for _, w := range c.config.MaintenanceWindows {
+		if w.Open(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextMaintenanceWindow returns the time at which the next maintenance
+// window opens, or nil in case none of them opens anymore
+func (c *Client) nextMaintenanceWindow(t time.Time) *time.Time {
+
+	var next *time.Time
+
+	for _, w := range c.config.MaintenanceWindows {
+		n := w.Next(t)
+		if !n.IsZero() && (next == nil || n.Before(*next)) {
+			next = &n
+		}
+	}
+
+	return next
+}
+
+// MaintenanceStatus returns whether the device is within a maintenance
+// window, and the configuration pending until the next one opens, if any.
+// It returns nil in case no maintenance windows are configured.
+func (c *Client) MaintenanceStatus() *structs.MaintenanceStatus {
+
+	if len(c.config.MaintenanceWindows) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	status := &structs.MaintenanceStatus{
+		InWindow:   c.inMaintenanceWindow(now),
+		NextWindow: c.nextMaintenanceWindow(now),
+	}
+
+	pending, err := c.state.PendingConfiguration()
+	if err != nil {
+		c.logger.Warnf("could not read pending configuration: %v", err)
+	}
+
+	if pending != nil {
+		status.PendingSince = &pending.ReceivedAt
+		status.PendingHash = fmt.Sprintf("%x", pending.Configuration.Hash())
+	}
+
+	return status
+}
+
+// holdConfiguration stores the configuration received from the API as
+// pending rather than applying it, in case it differs from the one last
+// applied and no maintenance window is open, unless the change is flagged
+// as urgent. The first configuration received by a device is applied right
+// away. While a configuration is pending, the one last applied keeps being
+// reconciled, so that drift is repaired and failed modules are retried.
+// It returns true if the configuration was held.
+func (c *Client) holdConfiguration(resp *structs.DeviceSyncResponse) bool {
+
+	now := time.Now()
+
+	if c.inMaintenanceWindow(now) {
+		return false
+	}
+
+	applied, err := c.appliedRemoteConfiguration(c.state)
+	if err != nil {
+		c.logger.Errorf("could not read the configuration last applied: %v", err)
+		return false
+	}
+
+	if applied == nil || applied.Hash() == resp.Configuration.Hash() {
+		return false
+	}
+
+	if resp.Urgent {
+		c.emitEvent(structs.EventTypeWarning, "maintenance", "applying urgent configuration change outside of maintenance windows")
+		return false
+	}
+
+	pending, err := c.state.PendingConfiguration()
+	if err != nil {
+		c.logger.Warnf("could not read pending configuration: %v", err)
+	}
+
+	// Overrides are read from the repository itself, which must
+	// not be accessed from within the transaction below
+	desired := c.overriddenConfiguration(applied)
+
+	err = c.updateState(func(tx state.Transaction) error {
+
+		if pending == nil || pending.Configuration.Hash() != resp.Configuration.Hash() {
+
+			if next := c.nextMaintenanceWindow(now); next != nil {
+				c.emitEvent(structs.EventTypeInfo, "maintenance", "configuration change held until the next maintenance window at %s", next.Format(time.RFC3339))
+			} else {
+				c.emitEvent(structs.EventTypeWarning, "maintenance", "configuration change held, but no maintenance window is scheduled")
+			}
+
+			pending := &structs.PendingConfiguration{
+				Configuration: resp.Configuration,
+				Meta:          resp.Meta,
+				ReceivedAt:    now,
+			}
+
+			if err := tx.SetPendingConfiguration(pending); err != nil {
+				return err
+			}
+		}
+
+		c.reconcileModules(tx, desired, applied)
+
+		return nil
+	})
+	if err != nil {
+		c.logger.Errorf("error holding configuration until the next maintenance window: %v", err)
+	}
+
+	return true
+}
+
+// appliedRemoteConfiguration returns the remote configuration last applied,
+// i.e. the latest one in the history, or nil in case there is none
+func (c *Client) appliedRemoteConfiguration(tx state.Transaction) (*structs.Configuration, error) {
+
+	latest, err := c.latestConfigurationVersion(tx, structs.ConfigurationVersionRemote)
+	if err != nil || latest == nil {
+		return nil, err
+	}
+
+	applied := &structs.Configuration{}
+	if err := json.Unmarshal(latest.Configuration, applied); err != nil {
+		return nil, fmt.Errorf("could not decode remote configuration: %v", err)
+	}
+
+	return applied, nil
+}
+
+// ApplyPendingConfiguration applies the pending configuration right
+// away, regardless of the maintenance windows
+func (c *Client) ApplyPendingConfiguration() error {
+
+	c.shutdownLock.Lock()
+
+	if c.shutdown {
+		c.shutdownLock.Unlock()
+		return fmt.Errorf("client is shutting down")
+	}
+
+	err := c.applyPendingConfigurationNow()
+
+	c.shutdownLock.Unlock()
+
+	c.runQueuedHooks()
+
+	return err
+}
+
+func (c *Client) applyPendingConfigurationNow() error {
+
+	pending, err := c.state.PendingConfiguration()
+	if err != nil {
+		return err
+	}
+
+	if pending == nil {
+		return structs.NewInvalidInputError("no pending configuration")
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "maintenance", "applying pending configuration on demand")
+
+	return c.applyPendingConfiguration(pending)
+}
+
+// applyPendingConfigurationInWindow applies the pending configuration
+// once a maintenance window opens, even if the API cannot be reached.
+// It must be called with the shutdown lock held.
+func (c *Client) applyPendingConfigurationInWindow() {
+
+	if len(c.config.MaintenanceWindows) == 0 || !c.inMaintenanceWindow(time.Now()) {
+		return
+	}
+
+	pending, err := c.state.PendingConfiguration()
+	if err != nil {
+		c.logger.Warnf("could not read pending configuration: %v", err)
+		return
+	}
+
+	if pending == nil {
+		return
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "maintenance", "maintenance window open, applying pending configuration")
+
+	if err := c.applyPendingConfiguration(pending); err != nil {
+		c.logger.Errorf("error applying pending configuration: %v", err)
+	}
+}
+
+func (c *Client) applyPendingConfiguration(pending *structs.PendingConfiguration) error {
+
+	resp := &structs.DeviceSyncResponse{
+		Configuration: pending.Configuration,
+	}
+	resp.Meta = pending.Meta
+
+	return c.applyConfiguration(resp)
+}
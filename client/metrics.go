@@ -0,0 +1,38 @@
+package client
+
+import (
+	"sync"
+)
+
+// metrics contains the counters maintained by the client, e.g. the number
+// of times drift was detected in the files rendered by each module.
+type metrics struct {
+	lock     sync.Mutex
+	counters map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		counters: map[string]uint64{},
+	}
+}
+
+func (m *metrics) incr(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[name]++
+}
+
+// Metrics returns a snapshot of the counters maintained by the client
+func (c *Client) Metrics() map[string]uint64 {
+
+	c.metrics.lock.Lock()
+	defer c.metrics.lock.Unlock()
+
+	out := make(map[string]uint64, len(c.metrics.counters))
+	for k, v := range c.metrics.counters {
+		out[k] = v
+	}
+
+	return out
+}
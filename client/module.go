@@ -1,10 +1,442 @@
 package client
 
 import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
 	state "github.com/seashell/agent/client/state"
 	log "github.com/seashell/agent/pkg/log"
+	structs "github.com/seashell/agent/seashell/structs"
 )
 
+// module is a unit of configuration managed by the client
+type module struct {
+	name string
+
+	// dependencies are the modules which must be healthy
+	// before the module is reconciled
+	dependencies []string
+
+	// labels indicates whether the module renders the device labels,
+	// in which case it fails if any of them cannot be interpolated
+	labels bool
+
+	reconcile func(c *Client, tx state.Transaction, config, remote *structs.Configuration) error
+
+	// ready returns an error in case the module is not healthy after being
+	// reconciled, e.g. because the interface it configures is not up yet.
+	// Modules without a readiness check are healthy once reconciled.
+	ready func(c *Client, config *structs.Configuration) error
+
+	// plan returns the changes the module would apply when reconciled,
+	// without writing any files nor modifying the client state
+	plan func(c *Client, tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error)
+}
+
+// moduleDefinitions returns the modules managed by the client
+func moduleDefinitions() []*module {
+	return []*module{
+		{
+			name:      "drago",
+			reconcile: (*Client).reconcileDragoConfiguration,
+			plan:      (*Client).planDragoConfiguration,
+			ready:     (*Client).dragoReady,
+		},
+		{
+			name:         "nomad",
+			dependencies: []string{"drago"},
+			labels:       true,
+			reconcile:    (*Client).reconcileNomadConfiguration,
+			plan:         (*Client).planNomadConfiguration,
+		},
+		{
+			name:         "consul",
+			dependencies: []string{"drago"},
+			labels:       true,
+			reconcile:    (*Client).reconcileConsulConfiguration,
+			plan:         (*Client).planConsulConfiguration,
+		},
+		{
+			name:      "files",
+			labels:    true,
+			reconcile: (*Client).reconcileFilesConfiguration,
+			plan:      (*Client).planFilesConfiguration,
+		},
+		{
+			name:      "runtime",
+			reconcile: (*Client).reconcileContainerRuntimeConfiguration,
+			plan:      (*Client).planContainerRuntimeConfiguration,
+		},
+	}
+}
+
+// ModuleNames returns the names of the modules managed by the client
+func ModuleNames() []string {
+	names := []string{}
+	for _, m := range moduleDefinitions() {
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// sortModules returns the modules in topological order, so that each
+// module comes after its dependencies. Modules which do not depend on
+// each other are kept in their original order.
+func sortModules(modules []*module) ([]*module, error) {
+
+	byName := map[string]*module{}
+	for _, m := range modules {
+		byName[m.name] = m
+	}
+
+	for _, m := range modules {
+		for _, d := range m.dependencies {
+			if _, ok := byName[d]; !ok {
+				return nil, fmt.Errorf("module %s depends on unknown module %s", m.name, d)
+			}
+		}
+	}
+
+	sorted := []*module{}
+	done := map[string]bool{}
+
+	for len(sorted) < len(modules) {
+
+		progress := false
+
+		for _, m := range modules {
+			if done[m.name] {
+				continue
+			}
+			satisfied := true
+			for _, d := range m.dependencies {
+				if !done[d] {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				sorted = append(sorted, m)
+				done[m.name] = true
+				progress = true
+			}
+		}
+
+		if !progress {
+			cycle := []string{}
+			for _, m := range modules {
+				if !done[m.name] {
+					cycle = append(cycle, m.name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between modules %s", strings.Join(cycle, ", "))
+		}
+	}
+
+	return sorted, nil
+}
+
+// moduleStatuses keeps track of the reconciliation status of each module
+type moduleStatuses struct {
+	lock     sync.Mutex
+	statuses map[string]*structs.ModuleStatus
+
+	// hashes contains the hash of the configuration with which each
+	// module last failed, so that a module in backoff is retried
+	// as soon as its configuration changes
+	hashes map[string]uint64
+}
+
+func newModuleStatuses() *moduleStatuses {
+	s := &moduleStatuses{
+		statuses: map[string]*structs.ModuleStatus{},
+		hashes:   map[string]uint64{},
+	}
+	for _, m := range moduleDefinitions() {
+		s.statuses[m.name] = &structs.ModuleStatus{
+			Name:         m.name,
+			State:        structs.ModuleStatePending,
+			Dependencies: m.dependencies,
+		}
+	}
+	return s
+}
+
+// restore restores the history of each module from the statuses persisted
+// in the client state. Modules are pending until reconciled again, and are
+// not kept in backoff across restarts.
+func (s *moduleStatuses) restore(persisted []*structs.ModuleStatus) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, p := range persisted {
+		status, ok := s.statuses[p.Name]
+		if !ok {
+			continue
+		}
+		status.LastAttempt = p.LastAttempt
+		status.LastSuccess = p.LastSuccess
+		status.ConsecutiveFailures = p.ConsecutiveFailures
+		status.LastError = p.LastError
+	}
+}
+
+func (s *moduleStatuses) set(name string, state string, blockedBy []string, err error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := s.statuses[name]
+	status.State = state
+	status.BlockedBy = blockedBy
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+}
+
+// attempted records the outcome of a reconciliation of a module with
+// a configuration, returning the time after which a failed module
+// can be retried.
+func (s *moduleStatuses) attempted(name string, now time.Time, hash uint64, err error) time.Time {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := s.statuses[name]
+	status.LastAttempt = &now
+	status.NextAttempt = nil
+
+	if err == nil {
+		status.LastSuccess = &now
+		status.ConsecutiveFailures = 0
+		delete(s.hashes, name)
+		return now
+	}
+
+	status.State = structs.ModuleStateFailed
+	status.BlockedBy = nil
+	status.Error = err.Error()
+	status.LastError = err.Error()
+	status.ConsecutiveFailures++
+
+	next := now.Add(moduleRetryBackoff(status.ConsecutiveFailures))
+	status.NextAttempt = &next
+	s.hashes[name] = hash
+
+	return next
+}
+
+// backingOff returns true if the module failed with the same configuration
+// and its next attempt is not due yet.
+func (s *moduleStatuses) backingOff(name string, now time.Time, hash uint64) bool {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := s.statuses[name]
+	if status.State != structs.ModuleStateFailed || status.NextAttempt == nil {
+		return false
+	}
+
+	return s.hashes[name] == hash && now.Before(*status.NextAttempt)
+}
+
+// due returns true if any failed module is due to be retried
+func (s *moduleStatuses) due(now time.Time) bool {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, status := range s.statuses {
+		if status.State == structs.ModuleStateFailed && status.NextAttempt != nil && !now.Before(*status.NextAttempt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *moduleStatuses) state(name string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.statuses[name].State
+}
+
+// moduleRetryBackoff returns how long to wait before retrying a module
+// after a number of consecutive failures, doubling from the base retry
+// interval up to the maximum one.
+func moduleRetryBackoff(failures int) time.Duration {
+
+	backoff := defaultModuleRetryInterval
+
+	for i := 1; i < failures && backoff < defaultModuleMaxRetryInterval; i++ {
+		backoff *= 2
+	}
+
+	if backoff > defaultModuleMaxRetryInterval {
+		backoff = defaultModuleMaxRetryInterval
+	}
+
+	return backoff
+}
+
+// ModuleStatuses returns the reconciliation status of each module
+func (c *Client) ModuleStatuses() []*structs.ModuleStatus {
+
+	c.modules.lock.Lock()
+	defer c.modules.lock.Unlock()
+
+	out := []*structs.ModuleStatus{}
+	for _, m := range moduleDefinitions() {
+		status := *c.modules.statuses[m.name]
+		out = append(out, &status)
+	}
+
+	return out
+}
+
+// loadModuleStatuses restores the module statuses persisted in the client state
+func (c *Client) loadModuleStatuses() {
+
+	persisted, err := c.state.ModuleStatuses()
+	if err != nil {
+		c.logger.Warnf("could not read module statuses: %v", err)
+		return
+	}
+
+	c.modules.restore(persisted)
+}
+
+// saveModuleStatuses persists the module statuses in the client state
+func (c *Client) saveModuleStatuses(tx state.Transaction) {
+	for _, status := range c.ModuleStatuses() {
+		if err := tx.SetModuleStatus(status); err != nil {
+			c.logger.Warnf("could not persist %s status: %v", status.Name, err)
+		}
+	}
+}
+
+// reconcileModules reconciles each module in dependency order. Modules
+// whose dependencies are not healthy are blocked, i.e. deferred until a
+// later reconciliation in which their dependencies report healthy. Failed
+// modules are backed off, unless their configuration changes.
+func (c *Client) reconcileModules(tx state.Transaction, config, remote *structs.Configuration) {
+
+	modules, err := sortModules(moduleDefinitions())
+	if err != nil {
+		c.logger.Errorf("could not order modules: %v", err)
+		return
+	}
+
+	c.desired, c.remote = config, remote
+
+	now := time.Now()
+	hash := config.Hash()
+
+	// Labels are interpolated on every attempt, so that references
+	// to facts which were not collected yet, e.g. custom facts, are
+	// retried. Undefined references cause the modules which render
+	// labels to fail, while the others are reconciled without them.
+	resolved, interpolationErr := c.interpolatedConfiguration(config)
+	if interpolationErr == nil {
+		c.hooks.setLabels(resolved.Labels)
+	}
+
+	for _, m := range modules {
+
+		blockedBy := []string{}
+		for _, d := range m.dependencies {
+			if c.modules.state(d) != structs.ModuleStateHealthy {
+				blockedBy = append(blockedBy, d)
+			}
+		}
+
+		if len(blockedBy) > 0 {
+			if c.modules.state(m.name) != structs.ModuleStateBlocked {
+				c.emitEvent(structs.EventTypeInfo, m.name, "waiting for %s to become healthy", strings.Join(blockedBy, ", "))
+			}
+			c.modules.set(m.name, structs.ModuleStateBlocked, blockedBy, nil)
+			continue
+		}
+
+		if c.modules.backingOff(m.name, now, hash) {
+			continue
+		}
+
+		var err error
+		if m.labels {
+			err = interpolationErr
+		}
+		if err == nil {
+			err = m.reconcile(c, tx, resolved, remote)
+		}
+		next := c.modules.attempted(m.name, now, hash, err)
+		if err != nil {
+			c.logger.Warnf("error reconciling %s configuration, retrying in %s: %v", m.name, next.Sub(now), err)
+			continue
+		}
+
+		if m.ready != nil {
+			if err := m.ready(c, resolved); err != nil {
+				c.logger.Debugf("%s is not ready: %v", m.name, err)
+				c.modules.set(m.name, structs.ModuleStateUnhealthy, nil, err)
+				continue
+			}
+		}
+
+		c.modules.set(m.name, structs.ModuleStateHealthy, nil, nil)
+	}
+
+	c.saveModuleStatuses(tx)
+}
+
+// retryFailedModules reconciles the latest configuration again
+// in case any failed module is due to be retried.
+func (c *Client) retryFailedModules() {
+
+	if c.desired == nil || !c.modules.due(time.Now()) {
+		return
+	}
+
+	c.logger.Debugf("retrying failed modules")
+
+	err := c.updateState(func(tx state.Transaction) error {
+		c.reconcileModules(tx, c.desired, c.remote)
+		return nil
+	})
+	if err != nil {
+		c.logger.Errorf("error persisting client state: %v", err)
+	}
+}
+
+// dragoReady returns an error unless a Drago interface is up. If the
+// configuration does not specify any Drago servers, no interface is
+// expected to come up, and the module is considered ready.
+func (c *Client) dragoReady(config *structs.Configuration) error {
+
+	if len(config.DragoIPAddresses) == 0 {
+		return nil
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
+
+	for _, iface := range ifaces {
+		if strings.HasPrefix(iface.Name, c.config.Drago.InterfacePrefix) && iface.Flags&net.FlagUp != 0 {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no %s* interface is up", c.config.Drago.InterfacePrefix)
+}
+
 // ModuleService :
 type ModuleService struct {
 	config *Config
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+func TestReconcileModules_UndefinedLabel(t *testing.T) {
+
+	c := testClient(t, &Config{
+		OutputDir: t.TempDir(),
+		FactsRoot: "testdata/facts/x86",
+	})
+
+	config := &structs.Configuration{
+		Labels: map[string]string{
+			"host": "${fact.hostname}",
+			"rack": "${fact.rack}",
+		},
+	}
+
+	err := c.state.Update(func(tx state.Transaction) error {
+		c.reconcileModules(tx, config, config)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the modules which render labels fail
+	expected := map[string]string{
+		"drago":   structs.ModuleStateHealthy,
+		"nomad":   structs.ModuleStateFailed,
+		"consul":  structs.ModuleStateFailed,
+		"files":   structs.ModuleStateFailed,
+		"runtime": structs.ModuleStateHealthy,
+	}
+	for name, s := range expected {
+		if got := c.modules.state(name); got != s {
+			t.Errorf("unexpected state of %s: %s", name, got)
+		}
+	}
+
+	// Labels which could be interpolated are kept
+	drago, err := c.state.DragoConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drago == nil || !reflect.DeepEqual(drago.Meta, map[string]string{"host": "edge-01"}) {
+		t.Fatalf("unexpected drago configuration: %+v", drago)
+	}
+}
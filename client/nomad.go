@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultNomadRegion     = "global"
+	defaultNomadDatacenter = "global"
+)
+
+// defaultNomadHostNetworks returns the host networks of Nomad clients whose
+// configuration does not specify any: the Drago interface as "private",
+// and the first public interface as "public".
+func defaultNomadHostNetworks(dragoInterfacePrefix string) []*structs.NomadHostNetwork {
+	return []*structs.NomadHostNetwork{
+		{
+			Name:      "private",
+			Interface: fmt.Sprintf(`{{ GetPrivateInterfaces | include "name" "^%s" | limit 1 | attr "name" }}`, dragoInterfacePrefix),
+		},
+		{
+			Name:      "public",
+			Interface: `{{ GetPublicInterfaces | limit 1 | attr "name" }}`,
+		},
+	}
+}
+
+// defaultNomadPlugins returns the plugins of Nomad clients
+// whose configuration does not specify any.
+func defaultNomadPlugins() []*structs.NomadPlugin {
+	return []*structs.NomadPlugin{
+		{
+			Name: "docker",
+			Config: map[string]interface{}{
+				"allow_caps": []interface{}{"ALL"},
+			},
+		},
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// overrideFileExpiresAtKey is the attribute of override files
+	// containing their expiry time, in RFC 3339 format.
+	overrideFileExpiresAtKey = "expires_at"
+)
+
+// Override returns the configuration override set through the API, if any
+func (c *Client) Override() (*structs.ConfigurationOverride, error) {
+	return c.state.ConfigurationOverride()
+}
+
+// SetOverride sets the configuration override, which is persisted in
+// the client state and applied starting from the next reconciliation.
+func (c *Client) SetOverride(o *structs.ConfigurationOverride) error {
+
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	if o.Expired(time.Now()) {
+		return structs.NewInvalidInputError("override expiry time is in the past")
+	}
+
+	o.Source = structs.OverrideSourceAPI
+	o.UpdatedAt = time.Now()
+
+	if err := c.state.SetConfigurationOverride(o); err != nil {
+		return err
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "override", "configuration override set")
+
+	return nil
+}
+
+// DeleteOverride deletes the configuration override set through the API
+func (c *Client) DeleteOverride() error {
+
+	if err := c.state.DeleteConfigurationOverride(); err != nil {
+		return err
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "override", "configuration override deleted")
+
+	return nil
+}
+
+// activeOverrides returns the overrides to be applied over the remote
+// configuration, in order: the override file first, and then the override
+// set through the API. Expired overrides set through the API are deleted.
+func (c *Client) activeOverrides() []*structs.ConfigurationOverride {
+
+	now := time.Now()
+
+	overrides := []*structs.ConfigurationOverride{}
+
+	if c.config.OverrideFile != "" {
+		o, err := loadOverrideFile(c.config.OverrideFile)
+		if err != nil && !os.IsNotExist(err) {
+			c.emitEvent(structs.EventTypeWarning, "override", "could not load override file: %v", err)
+		} else if o != nil {
+			if o.Expired(now) {
+				c.logger.Debugf("override file %s expired at %s, ignoring it", c.config.OverrideFile, o.ExpiresAt)
+			} else {
+				overrides = append(overrides, o)
+			}
+		}
+	}
+
+	o, err := c.state.ConfigurationOverride()
+	if err != nil {
+		c.logger.Warnf("could not read configuration override: %v", err)
+	} else if o != nil {
+		if o.Expired(now) {
+			c.emitEvent(structs.EventTypeInfo, "override", "configuration override expired at %s", o.ExpiresAt)
+			if err := c.state.DeleteConfigurationOverride(); err != nil {
+				c.logger.Warnf("could not delete expired configuration override: %v", err)
+			}
+		} else {
+			overrides = append(overrides, o)
+		}
+	}
+
+	return overrides
+}
+
+// overrides returns the overrides currently in effect. Unlike
+// activeOverrides, it does not delete expired overrides nor emit events.
+func (c *Client) overrides() []*structs.ConfigurationOverride {
+
+	now := time.Now()
+
+	overrides := []*structs.ConfigurationOverride{}
+
+	if c.config.OverrideFile != "" {
+		if o, err := loadOverrideFile(c.config.OverrideFile); err == nil && !o.Expired(now) {
+			overrides = append(overrides, o)
+		}
+	}
+
+	if o, err := c.state.ConfigurationOverride(); err == nil && o != nil && !o.Expired(now) {
+		overrides = append(overrides, o)
+	}
+
+	return overrides
+}
+
+// overriddenConfiguration returns the remote configuration
+// with all active local overrides applied over it.
+func (c *Client) overriddenConfiguration(remote *structs.Configuration) *structs.Configuration {
+	return c.applyOverrides(remote, c.activeOverrides())
+}
+
+// applyOverrides returns the remote configuration with
+// the given overrides applied over it, in order.
+func (c *Client) applyOverrides(remote *structs.Configuration, overrides []*structs.ConfigurationOverride) *structs.Configuration {
+
+	config := remote
+
+	for _, o := range overrides {
+		overridden, err := config.Override(o)
+		if err != nil {
+			c.emitEvent(structs.EventTypeWarning, "override", "could not apply %s override: %v", o.Source, err)
+			continue
+		}
+		config = overridden
+	}
+
+	return config
+}
+
+// loadOverrideFile loads an override from an HCL file, whose attributes
+// are named after the JSON fields of the Configuration struct, e.g.
+//
+//	labels = {
+//	  debug = "true"
+//	}
+//	dragoIpAddresses = ["10.0.0.1"]
+//	expires_at = "2021-03-01T12:00:00Z"
+func loadOverrideFile(path string) (*structs.ConfigurationOverride, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("error parsing override file: %v", diags.Error())
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("error parsing override file: %v", diags.Error())
+	}
+
+	o := &structs.ConfigurationOverride{
+		Source:    structs.OverrideSourceFile,
+		Values:    map[string]interface{}{},
+		UpdatedAt: info.ModTime(),
+	}
+
+	for name, attr := range attrs {
+
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error evaluating %s: %v", name, diags.Error())
+		}
+
+		encoded, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("error evaluating %s: %v", name, err)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(encoded, &value); err != nil {
+			return nil, err
+		}
+
+		if name == overrideFileExpiresAtKey {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a string", name)
+			}
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			o.ExpiresAt = &t
+			continue
+		}
+
+		o.Values[name] = value
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
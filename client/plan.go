@@ -0,0 +1,457 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	boltdb "github.com/seashell/agent/client/state/boltdb"
+	inmem "github.com/seashell/agent/client/state/inmem"
+	diff "github.com/seashell/agent/pkg/diff"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// defaultPlanStateTimeout is how long planning waits for the
+	// state DB lock, which is held while the agent is running.
+	defaultPlanStateTimeout = 1 * time.Second
+)
+
+type hashable interface {
+	Hash() uint64
+}
+
+// Plan contains the changes the client would apply to each module
+// if the desired configuration were reconciled.
+type Plan struct {
+	Modules []*ModulePlan
+
+	// StateKnown indicates whether the stored state could be read.
+	// Otherwise, the plan only compares against the files on disk,
+	// and overrides set through the API and pins are not accounted for.
+	StateKnown bool
+}
+
+// HasChanges returns true if any of the modules has pending changes
+func (p *Plan) HasChanges() bool {
+	for _, m := range p.Modules {
+		if m.HasChanges() {
+			return true
+		}
+	}
+	return false
+}
+
+// ModulePlan contains the pending changes of a single module.
+type ModulePlan struct {
+	Module string
+
+	// Files contains the files the module would write or delete
+	Files []*FilePlan
+
+	// StateChanged indicates whether the stored state differs from
+	// the desired configuration, which triggers a re-render
+	StateChanged bool
+
+	// Pinned is the version to which the module is pinned, if any
+	Pinned uint64
+
+	// Error is set in case the desired configuration is invalid,
+	// in which case the module would fail to reconcile
+	Error string
+}
+
+// HasChanges returns true if the module has pending changes
+func (p *ModulePlan) HasChanges() bool {
+	if p.StateChanged || p.Error != "" {
+		return true
+	}
+	for _, f := range p.Files {
+		if f.HasChanges() {
+			return true
+		}
+	}
+	return false
+}
+
+// FilePlan contains the pending changes of a single file
+type FilePlan struct {
+	Path string
+
+	// Current is the content of the file currently on disk
+	Current string
+
+	// Desired is the content that would be written
+	Desired string
+
+	// Exists indicates whether the file currently exists
+	Exists bool
+
+	// Delete indicates that the file would be deleted
+	Delete bool
+
+	// Sensitive indicates that the contents must not be displayed,
+	// e.g. for private keys
+	Sensitive bool
+
+	// secrets are redacted from the contents when displaying them
+	secrets []string
+}
+
+// HasChanges returns true if the file would be written or deleted
+func (p *FilePlan) HasChanges() bool {
+	if p.Delete {
+		return p.Exists
+	}
+	return !p.Exists || p.Current != p.Desired
+}
+
+// Diff returns a unified diff between the current and desired file
+// contents with secrets redacted, which is empty for sensitive files
+func (p *FilePlan) Diff() string {
+	if p.Sensitive {
+		return ""
+	}
+	current := diff.RedactValues(p.Current, p.secrets)
+	desired := diff.RedactValues(p.Desired, p.secrets)
+	return diff.Unified(current, desired, p.Path, p.Path+" (desired)")
+}
+
+// NewPlan authenticates against the API, fetches the desired configuration
+// and computes the changes that would be applied by the client, without
+// writing anything to the output directory or to the client state. As
+// during reconciliations, overrides and pins are applied, and labels
+// are interpolated.
+func NewPlan(config *Config) (*Plan, error) {
+
+	c := newClient(config)
+
+	if err := c.setupDevice(); err != nil {
+		return nil, fmt.Errorf("error setting up device: %v", err)
+	}
+
+	if err := c.setupAPIClient(); err != nil {
+		return nil, fmt.Errorf("error setting up api client: %v", err)
+	}
+
+	if err := c.getToken(); err != nil {
+		return nil, fmt.Errorf("error obtaining auth token: %v", err)
+	}
+
+	resp, err := c.syncConfiguration()
+	if err != nil {
+		return nil, fmt.Errorf("error syncing device: %v", err)
+	}
+
+	known, err := c.openPlanState()
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := c.state.(io.Closer); ok && c.config.StateRepository == nil {
+		defer closer.Close()
+	}
+
+	remote := resp.Configuration
+
+	desired, interpolationErr := c.interpolatedConfiguration(c.applyOverrides(remote, c.overrides()))
+
+	modules, err := sortModules(moduleDefinitions())
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{StateKnown: known}
+
+	for _, m := range modules {
+
+		if m.labels && interpolationErr != nil {
+			plan.Modules = append(plan.Modules, &ModulePlan{Module: m.name, Error: interpolationErr.Error()})
+			continue
+		}
+
+		p, err := m.plan(c, c.state, desired, remote)
+		if err != nil {
+			return nil, fmt.Errorf("error planning %s configuration: %v", m.name, err)
+		}
+
+		if !known {
+			p.StateChanged = false
+		}
+
+		plan.Modules = append(plan.Modules, p)
+	}
+
+	return plan, nil
+}
+
+// openPlanState opens the client state read-only with the configured
+// backend, returning false in case it cannot be read, e.g. because it
+// is kept in memory by a running agent, in which case the plan is
+// computed against an empty state.
+func (c *Client) openPlanState() (bool, error) {
+
+	if c.config.StateRepository != nil {
+		c.state = c.config.StateRepository
+		return true, nil
+	}
+
+	switch c.config.StateBackend {
+	case StateBackendBoltDB:
+		repo, err := boltdb.NewReadOnlyStateRepository(path.Join(c.config.StateDir, "client.state"), defaultPlanStateTimeout, c.logger)
+		if err == nil {
+			c.state = repo
+			return true, nil
+		}
+		c.logger.Warnf("could not read client state, comparing against rendered files only: %v", err)
+	case StateBackendInmem:
+		c.logger.Warnf("client state is kept in memory by the agent, comparing against rendered files only")
+	default:
+		return false, fmt.Errorf("unknown state backend %q", c.config.StateBackend)
+	}
+
+	c.state = inmem.NewStateRepository()
+
+	return false, nil
+}
+
+// planPin decodes the configuration version to which a module is pinned
+// into out, returning the version, or zero in case the module is not
+// pinned or its pin would be released. Unlike pinnedConfiguration, pins
+// are never released.
+func (c *Client) planPin(tx state.Transaction, module string, remote *structs.Configuration, out interface{}) uint64 {
+
+	pin, err := tx.ConfigurationPin(module)
+	if err != nil || pin == nil || pin.RemoteHash != remote.Hash() {
+		return 0
+	}
+
+	if !c.decodePinnedConfiguration(tx, pin, out) {
+		return 0
+	}
+
+	return pin.Version
+}
+
+func (c *Client) planDragoConfiguration(tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error) {
+
+	desired := c.desiredDragoConfiguration(config)
+
+	pinned := &structs.DragoConfiguration{}
+	version := c.planPin(tx, "drago", remote, pinned)
+	if version > 0 {
+		desired = pinned
+	}
+
+	current, err := tx.DragoConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.planModuleFile("drago", dragoTemplateString, desired, current, version, nil)
+}
+
+func (c *Client) planNomadConfiguration(tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error) {
+
+	desired := c.desiredNomadConfiguration(config)
+
+	pinned := &structs.NomadConfiguration{}
+	version := c.planPin(tx, "nomad", remote, pinned)
+	if version > 0 {
+		desired = pinned
+	}
+
+	current, err := tx.NomadConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.planModuleFile("nomad", nomadTemplateString, desired, current, version, nil)
+}
+
+func (c *Client) planConsulConfiguration(tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error) {
+
+	desired := c.desiredConsulConfiguration(config)
+
+	pinned := &structs.ConsulConfiguration{}
+	version := c.planPin(tx, "consul", remote, pinned)
+	if version > 0 {
+		desired = pinned
+	}
+
+	current, err := tx.ConsulConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.planModuleFile("consul", consulTemplateString, desired, current, version, c.consulTLSFileContents(desired))
+}
+
+func (c *Client) planFilesConfiguration(tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error) {
+
+	p := &ModulePlan{Module: "files"}
+
+	desired, err := c.desiredFilesConfiguration(config)
+	if err != nil {
+		p.Error = err.Error()
+		return p, nil
+	}
+
+	pinned := &structs.FilesConfiguration{}
+	if p.Pinned = c.planPin(tx, "files", remote, pinned); p.Pinned > 0 {
+		desired = pinned
+	}
+
+	current, err := tx.FilesConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	p.StateChanged = current.Hash() != desired.Hash()
+
+	keep := map[string]struct{}{}
+
+	for _, f := range desired.Files {
+		fp, err := planFile(f.Path, f.Content, false, true)
+		if err != nil {
+			return nil, err
+		}
+		p.Files = append(p.Files, fp)
+		keep[f.Path] = struct{}{}
+	}
+
+	if current != nil {
+		for _, f := range current.Files {
+			if _, ok := keep[f.Path]; ok {
+				continue
+			}
+			fp, err := planFile(f.Path, "", true, true)
+			if err != nil {
+				return nil, err
+			}
+			p.Files = append(p.Files, fp)
+		}
+	}
+
+	return p, nil
+}
+
+func (c *Client) planContainerRuntimeConfiguration(tx state.Transaction, config, remote *structs.Configuration) (*ModulePlan, error) {
+
+	p := &ModulePlan{Module: "runtime"}
+
+	desired := c.desiredContainerRuntimeConfiguration(config)
+
+	pinned := &structs.ContainerRuntimeConfiguration{}
+	if p.Pinned = c.planPin(tx, "runtime", remote, pinned); p.Pinned > 0 {
+		desired = pinned
+	}
+
+	current, err := tx.ContainerRuntimeConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	// Without runtime settings, the daemon configuration is left as is
+	if desired == nil {
+		p.StateChanged = current != nil
+		return p, nil
+	}
+
+	p.StateChanged = current.Hash() != desired.Hash()
+
+	out := c.config.ContainerRuntime.DaemonConfigPath
+
+	existing, err := ioutil.ReadFile(out)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if os.IsNotExist(err) && isEmptyContainerRuntimeConfiguration(desired) {
+		return p, nil
+	}
+
+	content, err := renderDaemonConfig(existing, desired)
+	if err != nil {
+		p.Error = err.Error()
+		return p, nil
+	}
+
+	fp, err := planFile(out, string(content), false, false)
+	if err != nil {
+		return nil, err
+	}
+	p.Files = append(p.Files, fp)
+
+	return p, nil
+}
+
+// planModuleFile plans the configuration file rendered by a template-based
+// module, along with the files it references, keyed by path, which are
+// deleted in case their content is empty.
+func (c *Client) planModuleFile(module string, tmpl string, desired hashable, current hashable, pinned uint64, files map[string]string) (*ModulePlan, error) {
+
+	rendered, err := renderTemplate(tmpl, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ModulePlan{
+		Module:       module,
+		StateChanged: current.Hash() != desired.Hash(),
+		Pinned:       pinned,
+	}
+
+	fp, err := planFile(path.Join(c.config.OutputDir, module+".hcl"), string(rendered), false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secrets such as tokens are redacted from the diff. Without the stored
+	// secrets, the current file may contain secrets other than the desired
+	// ones, so its contents are not displayed at all.
+	desiredSecrets, currentSecrets := diff.SensitiveValues(desired), diff.SensitiveValues(current)
+	if fp.Exists && len(desiredSecrets) > 0 && len(currentSecrets) == 0 {
+		fp.Sensitive = true
+	}
+	fp.secrets = append(desiredSecrets, currentSecrets...)
+
+	p.Files = append(p.Files, fp)
+
+	paths := make([]string, 0, len(files))
+	for f := range files {
+		paths = append(paths, f)
+	}
+	sort.Strings(paths)
+
+	for _, f := range paths {
+		fp, err := planFile(f, files[f], files[f] == "", true)
+		if err != nil {
+			return nil, err
+		}
+		p.Files = append(p.Files, fp)
+	}
+
+	return p, nil
+}
+
+func planFile(p string, desired string, delete bool, sensitive bool) (*FilePlan, error) {
+
+	buf, err := ioutil.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &FilePlan{
+		Path:      p,
+		Current:   string(buf),
+		Desired:   desired,
+		Exists:    err == nil,
+		Delete:    delete,
+		Sensitive: sensitive,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+func consulConfiguration(encrypt, agent, def string) *structs.Configuration {
+	return &structs.Configuration{
+		Consul: &structs.ConsulSettings{
+			Encrypt: encrypt,
+			ACL: &structs.ConsulACL{
+				Enabled: true,
+				Tokens:  &structs.ConsulACLTokens{Agent: agent, Default: def},
+			},
+		},
+	}
+}
+
+func planOutput(p *ModulePlan) string {
+	out := ""
+	for _, f := range p.Files {
+		out += f.Diff()
+	}
+	return out
+}
+
+func TestPlan_RedactsSecrets(t *testing.T) {
+
+	c := testClient(t, &Config{OutputDir: t.TempDir()})
+
+	current := consulConfiguration("old-gossip-key", "old-agent-token", "")
+
+	err := c.state.Update(func(tx state.Transaction) error {
+		return c.reconcileConsulConfiguration(tx, current, current)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desired := consulConfiguration("new-gossip-key", "new-agent-token", "new-default-token")
+
+	p, err := c.planConsulConfiguration(c.state, desired, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.HasChanges() || !p.Files[0].HasChanges() {
+		t.Fatalf("changed secrets not planned: %+v", p)
+	}
+
+	f := p.Files[0]
+	if !strings.Contains(f.Current, "old-gossip-key") || !strings.Contains(f.Desired, "new-agent-token") {
+		t.Fatalf("secrets not rendered:\n%s", f.Desired)
+	}
+
+	out := planOutput(p)
+	if !strings.Contains(out, "(sensitive)") {
+		t.Fatalf("secrets not redacted from the plan:\n%s", out)
+	}
+
+	for _, secret := range []string{"old-gossip-key", "old-agent-token", "new-gossip-key", "new-agent-token", "new-default-token"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q in plan:\n%s", secret, out)
+		}
+	}
+}
+
+func TestPlan_UnknownSecrets(t *testing.T) {
+
+	c := testClient(t, &Config{OutputDir: t.TempDir()})
+
+	err := c.state.Update(func(tx state.Transaction) error {
+		config := &structs.Configuration{DragoSecret: "old-drago-secret"}
+		return c.reconcileDragoConfiguration(tx, config, config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the stored state, e.g. while the agent is running, the
+	// secrets in the current file are unknown, so it is not displayed
+	c.state = testClient(t, &Config{}).state
+
+	desired := &structs.Configuration{DragoSecret: "new-drago-secret"}
+
+	p, err := c.planDragoConfiguration(c.state, desired, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := p.Files[0]
+	if !f.HasChanges() || !f.Sensitive || f.Diff() != "" {
+		t.Fatalf("unexpected plan of drago file: %+v", f)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"fmt"
+	"os"
+
+	boltdb "github.com/seashell/agent/client/state/boltdb"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// recoverState recovers from a corrupted state DB according to the
+// configured recovery mode, so that a corrupted disk does not cause
+// the agent to fail on every start.
+func (c *Client) recoverState(file string, cause error) (*boltdb.StateRepository, error) {
+
+	switch c.config.StateRecovery {
+	case StateRecoveryReset, StateRecoveryRestore:
+	case StateRecoveryNone:
+		return nil, cause
+	default:
+		return nil, fmt.Errorf("%v (unknown state recovery mode %q)", cause, c.config.StateRecovery)
+	}
+
+	moved, err := boltdb.MoveAside(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v (could not move it aside: %v)", cause, err)
+	}
+
+	c.emitEvent(structs.EventTypeWarning, "state", "client state is corrupted, moved it to %s: %v", moved, cause)
+
+	if c.config.StateRecovery == StateRecoveryRestore {
+		repo, err := c.restoreStateBackup(file)
+		if err == nil {
+			return repo, nil
+		}
+		c.emitEvent(structs.EventTypeWarning, "state", "could not restore client state backup, starting from a fresh state: %v", err)
+	}
+
+	return boltdb.OpenStateRepository(file, defaultAgentStateLockTimeout, c.logger)
+}
+
+// restoreStateBackup replaces the state DB with its latest backup
+func (c *Client) restoreStateBackup(file string) (*boltdb.StateRepository, error) {
+
+	backup, err := boltdb.LatestBackup(file)
+	if err != nil {
+		return nil, err
+	}
+	if backup == "" {
+		return nil, fmt.Errorf("no backups found")
+	}
+
+	if err := boltdb.RestoreBackup(backup, file); err != nil {
+		return nil, err
+	}
+
+	repo, err := boltdb.OpenStateRepository(file, defaultAgentStateLockTimeout, c.logger)
+	if err != nil {
+		// Do not leave an invalid backup in place of the state
+		os.Remove(file)
+		return nil, fmt.Errorf("backup %s is not valid: %v", backup, err)
+	}
+
+	c.emitEvent(structs.EventTypeInfo, "state", "restored client state from backup %s", backup)
+
+	return repo, nil
+}
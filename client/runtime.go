@@ -0,0 +1,352 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultDaemonConfigPath      = "/etc/docker/daemon.json"
+	defaultRuntimeSocketPath     = "/var/run/docker.sock"
+	defaultRuntimeRestartCommand = "systemctl restart docker"
+
+	runtimeRestartTimeout = 60 * time.Second
+	runtimePingTimeout    = 2 * time.Second
+
+	// runtimeReadyTimeout is how long the runtime is waited
+	// upon to become reachable again after being restarted.
+	runtimeReadyTimeout = 30 * time.Second
+)
+
+// runtimeManagedKeys are the keys of daemon.json managed by the client.
+// Any other keys present in the file are left untouched.
+var runtimeManagedKeys = []string{
+	"registry-mirrors",
+	"insecure-registries",
+	"log-driver",
+	"log-opts",
+	"storage-driver",
+}
+
+// ContainerRuntimeConfig contains the local settings of the runtime module
+type ContainerRuntimeConfig struct {
+
+	// DaemonConfigPath is the path to the Docker daemon configuration file
+	DaemonConfigPath string
+
+	// SocketPath is the path to the Unix socket of the runtime API
+	SocketPath string
+
+	// RestartCommand is run when the daemon configuration changes
+	RestartCommand string
+}
+
+// DefaultContainerRuntimeConfig returns the default settings of the runtime module
+func DefaultContainerRuntimeConfig() *ContainerRuntimeConfig {
+	return &ContainerRuntimeConfig{
+		DaemonConfigPath: defaultDaemonConfigPath,
+		SocketPath:       defaultRuntimeSocketPath,
+		RestartCommand:   defaultRuntimeRestartCommand,
+	}
+}
+
+// Merge combines two ContainerRuntimeConfig structs, returning the result
+func (c *ContainerRuntimeConfig) Merge(b *ContainerRuntimeConfig) *ContainerRuntimeConfig {
+	result := *c
+
+	if b.DaemonConfigPath != "" {
+		result.DaemonConfigPath = b.DaemonConfigPath
+	}
+	if b.SocketPath != "" {
+		result.SocketPath = b.SocketPath
+	}
+	if b.RestartCommand != "" {
+		result.RestartCommand = b.RestartCommand
+	}
+
+	return &result
+}
+
+// runtimeState keeps track of the restarts of the container runtime
+type runtimeState struct {
+	lock        sync.Mutex
+	lastRestart *time.Time
+}
+
+// desiredContainerRuntimeConfiguration returns the desired runtime
+// configuration, or nil in case the configuration has no runtime
+// settings, in which case the daemon configuration is not managed.
+func (c *Client) desiredContainerRuntimeConfiguration(config *structs.Configuration) *structs.ContainerRuntimeConfiguration {
+
+	if config.ContainerRuntime == nil {
+		return nil
+	}
+
+	return &structs.ContainerRuntimeConfiguration{
+		ContainerRuntimeSettings: *config.ContainerRuntime,
+	}
+}
+
+func (c *Client) reconcileContainerRuntimeConfiguration(tx state.Transaction, config, remote *structs.Configuration) error {
+
+	desired := c.desiredContainerRuntimeConfiguration(config)
+
+	if pinned := (&structs.ContainerRuntimeConfiguration{}); c.pinnedConfiguration(tx, "runtime", remote, pinned) {
+		desired = pinned
+	}
+
+	current, err := tx.ContainerRuntimeConfiguration()
+	if err != nil {
+		c.logger.Errorf("could not read runtime configuration: %v", err)
+	}
+
+	// The daemon configuration belongs to the operator unless the API sends
+	// runtime settings. Once it stops doing so, the file is left as is, and
+	// the stored configuration is deleted so that drift is no longer repaired.
+	if desired == nil {
+		if current == nil {
+			return nil
+		}
+		c.emitEvent(structs.EventTypeInfo, "runtime", "runtime settings removed from the configuration, no longer managing %s", c.config.ContainerRuntime.DaemonConfigPath)
+		return tx.DeleteConfiguration("runtime")
+	}
+
+	if current.Hash() != desired.Hash() {
+
+		c.logger.Debugf("changes detected in runtime configuration. rendering daemon configuration and persisting to repository...")
+
+		// The runtime is restarted even if the file is up to date, in case
+		// it was written by an earlier attempt whose restart failed
+		if err := c.applyContainerRuntimeConfiguration(desired, true); err != nil {
+			return err
+		}
+
+		if err := tx.SetContainerRuntimeConfiguration(desired); err != nil {
+			return err
+		}
+
+		c.recordConfigurationChange(tx, "runtime", current, desired)
+		c.recordConfigurationVersion(tx, "runtime", desired, nil)
+		c.moduleChanged("runtime")
+
+		return nil
+	}
+
+	c.logger.Debugf("no changes detected in runtime configuration. checking for drift...")
+
+	out := c.config.ContainerRuntime.DaemonConfigPath
+
+	existing, err := ioutil.ReadFile(out)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if os.IsNotExist(err) && isEmptyContainerRuntimeConfiguration(current) {
+		return nil
+	}
+
+	// Keys of daemon.json which are not managed by the client may be
+	// changed freely, so the file is only compared against the render
+	// of the managed keys over its current content.
+	expected, err := renderDaemonConfig(existing, current)
+	if err != nil {
+		return err
+	}
+
+	return c.repairDrift("runtime", map[string]string{out: checksum(expected)}, func() error {
+		return c.applyContainerRuntimeConfiguration(current, false)
+	})
+}
+
+// applyContainerRuntimeConfiguration renders the managed keys of the
+// daemon configuration over the existing file and, if its content changed,
+// atomically replaces it and restarts the runtime. If restart is true, the
+// runtime is restarted even if the content did not change.
+func (c *Client) applyContainerRuntimeConfiguration(desired *structs.ContainerRuntimeConfiguration, restart bool) error {
+
+	out := c.config.ContainerRuntime.DaemonConfigPath
+
+	existing, err := ioutil.ReadFile(out)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading daemon configuration: %v", err)
+	}
+
+	// Do not create a daemon configuration if there is nothing to manage
+	if os.IsNotExist(err) && isEmptyContainerRuntimeConfiguration(desired) {
+		return nil
+	}
+
+	content, err := renderDaemonConfig(existing, desired)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(content, existing) {
+		if !restart {
+			c.logger.Debugf("daemon configuration is up to date, not restarting runtime")
+			return nil
+		}
+		return c.restartContainerRuntime()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+
+	if err := writeFileAtomic(out, content, 0644); err != nil {
+		return err
+	}
+
+	return c.restartContainerRuntime()
+}
+
+// renderDaemonConfig returns the daemon configuration resulting from
+// setting the managed keys of an existing configuration to their desired
+// values, removing those which are unset in the desired configuration.
+func renderDaemonConfig(existing []byte, desired *structs.ContainerRuntimeConfiguration) ([]byte, error) {
+
+	config := map[string]interface{}{}
+
+	if len(bytes.TrimSpace(existing)) > 0 {
+		if err := json.Unmarshal(existing, &config); err != nil {
+			return nil, fmt.Errorf("error parsing existing daemon configuration: %v", err)
+		}
+	}
+
+	for _, k := range runtimeManagedKeys {
+		delete(config, k)
+	}
+
+	if len(desired.RegistryMirrors) > 0 {
+		config["registry-mirrors"] = desired.RegistryMirrors
+	}
+	if len(desired.InsecureRegistries) > 0 {
+		config["insecure-registries"] = desired.InsecureRegistries
+	}
+	if desired.LogDriver != "" {
+		config["log-driver"] = desired.LogDriver
+	}
+	if len(desired.LogOpts) > 0 {
+		config["log-opts"] = desired.LogOpts
+	}
+	if desired.StorageDriver != "" {
+		config["storage-driver"] = desired.StorageDriver
+	}
+
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(content, '\n'), nil
+}
+
+func isEmptyContainerRuntimeConfiguration(c *structs.ContainerRuntimeConfiguration) bool {
+	s := c.ContainerRuntimeSettings
+	return len(s.RegistryMirrors) == 0 && len(s.InsecureRegistries) == 0 &&
+		s.LogDriver == "" && len(s.LogOpts) == 0 && s.StorageDriver == ""
+}
+
+// restartContainerRuntime runs the restart command of the runtime,
+// and waits for it to become reachable again.
+func (c *Client) restartContainerRuntime() error {
+
+	args := strings.Fields(c.config.ContainerRuntime.RestartCommand)
+	if len(args) == 0 {
+		c.logger.Debugf("no runtime restart command configured")
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), runtimeRestartTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		c.emitEvent(structs.EventTypeError, "runtime", "could not restart runtime: %v: %s", err, strings.TrimSpace(string(out)))
+		return fmt.Errorf("error restarting runtime: %v", err)
+	}
+
+	now := time.Now()
+	c.runtime.lock.Lock()
+	c.runtime.lastRestart = &now
+	c.runtime.lock.Unlock()
+
+	deadline := time.Now().Add(runtimeReadyTimeout)
+	for {
+		err := c.pingContainerRuntime()
+		if err == nil {
+			c.emitEvent(structs.EventTypeInfo, "runtime", "runtime restarted")
+			return nil
+		}
+		if time.Now().After(deadline) {
+			c.emitEvent(structs.EventTypeWarning, "runtime", "runtime restarted, but is not reachable: %v", err)
+			return nil
+		}
+		select {
+		case <-time.After(1 * time.Second):
+		case <-c.shutdownCh:
+			return nil
+		}
+	}
+}
+
+// pingContainerRuntime pings the runtime API through its Unix socket
+func (c *Client) pingContainerRuntime() error {
+
+	socket := c.config.ContainerRuntime.SocketPath
+
+	httpClient := &http.Client{
+		Timeout: runtimePingTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	res, err := httpClient.Get("http://runtime/_ping")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	return nil
+}
+
+// ContainerRuntimeStatus returns the reachability of the container runtime
+func (c *Client) ContainerRuntimeStatus() *structs.ContainerRuntimeStatus {
+
+	status := &structs.ContainerRuntimeStatus{
+		Socket: c.config.ContainerRuntime.SocketPath,
+	}
+
+	if err := c.pingContainerRuntime(); err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Reachable = true
+	}
+
+	c.runtime.lock.Lock()
+	status.LastRestart = c.runtime.lastRestart
+	c.runtime.lock.Unlock()
+
+	return status
+}
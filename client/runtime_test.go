@@ -0,0 +1,251 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	state "github.com/seashell/agent/client/state"
+	inmem "github.com/seashell/agent/client/state/inmem"
+	simple "github.com/seashell/agent/pkg/log/simple"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// testClient returns a client backed by an in-memory state,
+// whose state directory is a temporary directory
+func testClient(t *testing.T, config *Config) *Client {
+	t.Helper()
+
+	logger, err := simple.NewLoggerAdapter(simple.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Logger = logger
+	if config.StateDir == "" {
+		config.StateDir = t.TempDir()
+	}
+
+	c := newClient(config)
+	c.state = inmem.NewStateRepository()
+
+	return c
+}
+
+// fakeRuntimeSocket serves the ping endpoint of the runtime API on a Unix
+// socket, and returns its path
+func fakeRuntimeSocket(t *testing.T, dir string) string {
+	t.Helper()
+
+	socket := filepath.Join(dir, "runtime.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte("OK"))
+	})
+
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return socket
+}
+
+// testRuntimeClient returns a client managing the daemon configuration
+// of a fake runtime, whose restart command creates a marker file
+func testRuntimeClient(t *testing.T) (*Client, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	daemon := filepath.Join(dir, "daemon.json")
+	restarted := filepath.Join(dir, "restarted")
+
+	c := testClient(t, &Config{
+		ContainerRuntime: &ContainerRuntimeConfig{
+			DaemonConfigPath: daemon,
+			SocketPath:       fakeRuntimeSocket(t, dir),
+			RestartCommand:   "touch " + restarted,
+		},
+	})
+
+	return c, daemon, restarted
+}
+
+func reconcileRuntime(t *testing.T, c *Client, config *structs.Configuration) {
+	t.Helper()
+
+	err := c.state.Update(func(tx state.Transaction) error {
+		return c.reconcileContainerRuntimeConfiguration(tx, config, config)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readDaemonConfig(t *testing.T, path string) map[string]interface{} {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestContainerRuntime_Unmanaged(t *testing.T) {
+
+	c, daemon, restarted := testRuntimeClient(t)
+
+	existing := []byte(`{"storage-driver":"overlay2","log-driver":"journald","live-restore":true}`)
+	if err := ioutil.WriteFile(daemon, existing, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileRuntime(t, c, &structs.Configuration{})
+
+	data, err := ioutil.ReadFile(daemon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(existing) {
+		t.Fatalf("daemon configuration modified without runtime settings: %s", data)
+	}
+	if exists(restarted) {
+		t.Fatal("runtime restarted without runtime settings")
+	}
+}
+
+func TestContainerRuntime_Apply(t *testing.T) {
+
+	c, daemon, restarted := testRuntimeClient(t)
+
+	if err := ioutil.WriteFile(daemon, []byte(`{"live-restore":true,"storage-driver":"overlay2"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &structs.Configuration{
+		ContainerRuntime: &structs.ContainerRuntimeSettings{
+			RegistryMirrors: []string{"https://mirror.local"},
+			LogDriver:       "journald",
+		},
+	}
+
+	reconcileRuntime(t, c, config)
+
+	out := readDaemonConfig(t, daemon)
+	if out["log-driver"] != "journald" || out["live-restore"] != true {
+		t.Fatalf("unexpected daemon configuration: %v", out)
+	}
+	if _, ok := out["storage-driver"]; ok {
+		t.Fatalf("unset managed key kept: %v", out)
+	}
+	if !exists(restarted) {
+		t.Fatal("runtime not restarted after a change")
+	}
+
+	status := c.ContainerRuntimeStatus()
+	if !status.Reachable || status.LastRestart == nil {
+		t.Fatalf("unexpected runtime status: %+v", status)
+	}
+
+	// An unchanged configuration does not restart the runtime
+	os.Remove(restarted)
+	reconcileRuntime(t, c, config)
+	if exists(restarted) {
+		t.Fatal("runtime restarted without a change")
+	}
+
+	// Once the runtime settings are removed, the file is left as is
+	reconcileRuntime(t, c, &structs.Configuration{})
+	if out := readDaemonConfig(t, daemon); out["log-driver"] != "journald" {
+		t.Fatalf("daemon configuration modified after runtime settings were removed: %v", out)
+	}
+	if exists(restarted) {
+		t.Fatal("runtime restarted after runtime settings were removed")
+	}
+
+	current, err := c.state.ContainerRuntimeConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != nil {
+		t.Fatalf("runtime configuration still stored: %+v", current)
+	}
+}
+
+func TestContainerRuntime_Unreachable(t *testing.T) {
+
+	c := testClient(t, &Config{
+		ContainerRuntime: &ContainerRuntimeConfig{
+			SocketPath: filepath.Join(t.TempDir(), "missing.sock"),
+		},
+	})
+
+	if status := c.ContainerRuntimeStatus(); status.Reachable || status.Error == "" {
+		t.Fatalf("unexpected runtime status: %+v", status)
+	}
+}
+
+func TestContainerRuntime_RestartRetried(t *testing.T) {
+
+	c, daemon, restarted := testRuntimeClient(t)
+
+	// The restart command fails on its first run
+	dir := filepath.Dir(daemon)
+	script := filepath.Join(dir, "restart.sh")
+	content := "#!/bin/sh\nif [ ! -e " + dir + "/failed ]; then touch " + dir + "/failed; exit 1; fi\ntouch " + restarted + "\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c.config.ContainerRuntime.RestartCommand = script
+
+	config := &structs.Configuration{
+		ContainerRuntime: &structs.ContainerRuntimeSettings{LogDriver: "journald"},
+	}
+
+	err := c.state.Update(func(tx state.Transaction) error {
+		return c.reconcileContainerRuntimeConfiguration(tx, config, config)
+	})
+	if err == nil {
+		t.Fatal("expected the restart to fail")
+	}
+
+	// The file was already written when the restart failed
+	if out := readDaemonConfig(t, daemon); out["log-driver"] != "journald" {
+		t.Fatalf("unexpected daemon configuration: %v", out)
+	}
+
+	reconcileRuntime(t, c, config)
+
+	if !exists(restarted) {
+		t.Fatal("failed restart not retried")
+	}
+
+	current, err := c.state.ContainerRuntimeConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current == nil || current.LogDriver != "journald" {
+		t.Fatalf("unexpected runtime configuration: %+v", current)
+	}
+}
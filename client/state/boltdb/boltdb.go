@@ -1,8 +1,10 @@
 package boltdb
 
 import (
-	"context"
+	"encoding/binary"
 	"encoding/json"
+	"os"
+	"time"
 
 	"github.com/seashell/agent/client/state"
 	"github.com/seashell/agent/pkg/log"
@@ -10,51 +12,84 @@ import (
 	bolt "go.etcd.io/bbolt"
 )
 
+const (
+	// maxConfigurationChanges is the number of configuration changes
+	// kept for each module, after which the oldest ones are discarded.
+	maxConfigurationChanges = 100
+)
+
 var (
-	configurationBucketName      = []byte("configuration")
-	dragoConfigurationObjectKey  = []byte("drago")
-	nomadConfigurationObjectKey  = []byte("nomad")
-	consulConfigurationObjectKey = []byte("consul")
+	configurationBucketName       = []byte("configuration")
+	changesBucketName             = []byte("changes")
+	historyBucketName             = []byte("history")
+	pinsBucketName                = []byte("pins")
+	checksumsBucketName           = []byte("checksums")
+	modulesBucketName             = []byte("modules")
+	dragoConfigurationObjectKey   = []byte("drago")
+	nomadConfigurationObjectKey   = []byte("nomad")
+	consulConfigurationObjectKey  = []byte("consul")
+	filesConfigurationObjectKey   = []byte("files")
+	runtimeConfigurationObjectKey = []byte("runtime")
+	overrideObjectKey             = []byte("override")
+	pendingObjectKey              = []byte("pending")
 )
 
 // StateRepository ...
 type StateRepository struct {
 	db *bolt.DB
-}
 
-// Transaction :s
-type Transaction struct {
-	bolt.Tx
+	// tx is the transaction within which operations are performed,
+	// in case the repository is bound to one
+	tx *bolt.Tx
 }
 
-// Commit :
-func (t *Transaction) Commit() error {
-	return t.Commit()
-}
+// OpenStateRepository opens the BoltDB state repository at path, creating
+// it if needed, and migrates it to the latest schema version. If timeout
+// is non-zero, opening the repository fails with ErrLocked if its lock
+// cannot be obtained within the timeout, e.g. because it is held by a
+// running agent. Otherwise, it waits indefinitely for the lock. In case
+// the repository is corrupted, ErrCorrupted is returned.
+func OpenStateRepository(path string, timeout time.Duration, logger log.Logger) (*StateRepository, error) {
 
-// NewStateRepository creates a new BoltDB state repository
-func NewStateRepository(path string, logger log.Logger) *StateRepository {
-	db, err := bolt.Open(path, 0666, nil)
+	db, err := open(path, &bolt.Options{Timeout: timeout})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	err = db.Update(func(tx *bolt.Tx) error {
+	if err := migrate(db, path, logger); err != nil {
+		db.Close()
+		return nil, err
+	}
 
-		_, err := tx.CreateBucketIfNotExists(configurationBucketName)
-		if err != nil {
-			return err
-		}
+	return &StateRepository{db: db}, nil
+}
 
-		return nil
-	})
+// NewReadOnlyStateRepository opens an existing BoltDB state repository in
+// read-only mode. Since BoltDB only allows a single writer, opening the
+// repository fails if its lock cannot be obtained within the timeout,
+// e.g. because it is held by a running agent.
+func NewReadOnlyStateRepository(path string, timeout time.Duration, logger log.Logger) (*StateRepository, error) {
 
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := open(path, &bolt.Options{ReadOnly: true, Timeout: timeout})
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	if err := checkSchemaVersion(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	return &StateRepository{db}
+	return &StateRepository{db: db}, nil
+}
 
+// Close closes the underlying database
+func (r *StateRepository) Close() error {
+	return r.db.Close()
 }
 
 // Name :
@@ -62,9 +97,17 @@ func (r *StateRepository) Name() string {
 	return "boltdb"
 }
 
-// Transaction :
-func (r *StateRepository) Transaction(ctx context.Context) state.Transaction {
-	return &Transaction{}
+// Update :
+func (r *StateRepository) Update(fn func(tx state.Transaction) error) error {
+
+	// Updates nested within a transaction are part of it
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return fn(&StateRepository{db: r.db, tx: tx})
+	})
 }
 
 // DragoConfiguration :
@@ -72,7 +115,7 @@ func (r *StateRepository) DragoConfiguration() (*structs.DragoConfiguration, err
 
 	var config *structs.DragoConfiguration
 
-	err := r.db.View(func(tx *bolt.Tx) error {
+	err := r.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 
 		data := b.Get(dragoConfigurationObjectKey)
@@ -91,7 +134,7 @@ func (r *StateRepository) DragoConfiguration() (*structs.DragoConfiguration, err
 
 // SetDragoConfiguration :
 func (r *StateRepository) SetDragoConfiguration(c *structs.DragoConfiguration) error {
-	err := r.db.Update(func(tx *bolt.Tx) error {
+	err := r.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 		return b.Put(dragoConfigurationObjectKey, encode(c))
 	})
@@ -103,7 +146,7 @@ func (r *StateRepository) NomadConfiguration() (*structs.NomadConfiguration, err
 
 	var config *structs.NomadConfiguration
 
-	err := r.db.View(func(tx *bolt.Tx) error {
+	err := r.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 
 		data := b.Get(nomadConfigurationObjectKey)
@@ -122,7 +165,7 @@ func (r *StateRepository) NomadConfiguration() (*structs.NomadConfiguration, err
 
 // SetNomadConfiguration :
 func (r *StateRepository) SetNomadConfiguration(c *structs.NomadConfiguration) error {
-	err := r.db.Update(func(tx *bolt.Tx) error {
+	err := r.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 		return b.Put(nomadConfigurationObjectKey, encode(c))
 	})
@@ -134,7 +177,7 @@ func (r *StateRepository) ConsulConfiguration() (*structs.ConsulConfiguration, e
 
 	var config *structs.ConsulConfiguration
 
-	err := r.db.View(func(tx *bolt.Tx) error {
+	err := r.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 
 		data := b.Get(consulConfigurationObjectKey)
@@ -153,13 +196,457 @@ func (r *StateRepository) ConsulConfiguration() (*structs.ConsulConfiguration, e
 
 // SetConsulConfiguration :
 func (r *StateRepository) SetConsulConfiguration(c *structs.ConsulConfiguration) error {
-	err := r.db.Update(func(tx *bolt.Tx) error {
+	err := r.update(func(tx *bolt.Tx) error {
 		b := tx.Bucket(configurationBucketName)
 		return b.Put(consulConfigurationObjectKey, encode(c))
 	})
 	return err
 }
 
+// FilesConfiguration :
+func (r *StateRepository) FilesConfiguration() (*structs.FilesConfiguration, error) {
+
+	var config *structs.FilesConfiguration
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+
+		data := b.Get(filesConfigurationObjectKey)
+		if data != nil {
+			config = &structs.FilesConfiguration{}
+			if err := decode(data, config); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return config, err
+}
+
+// SetFilesConfiguration :
+func (r *StateRepository) SetFilesConfiguration(c *structs.FilesConfiguration) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Put(filesConfigurationObjectKey, encode(c))
+	})
+	return err
+}
+
+// ContainerRuntimeConfiguration :
+func (r *StateRepository) ContainerRuntimeConfiguration() (*structs.ContainerRuntimeConfiguration, error) {
+
+	var config *structs.ContainerRuntimeConfiguration
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+
+		data := b.Get(runtimeConfigurationObjectKey)
+		if data != nil {
+			config = &structs.ContainerRuntimeConfiguration{}
+			if err := decode(data, config); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return config, err
+}
+
+// SetContainerRuntimeConfiguration :
+func (r *StateRepository) SetContainerRuntimeConfiguration(c *structs.ContainerRuntimeConfiguration) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Put(runtimeConfigurationObjectKey, encode(c))
+	})
+	return err
+}
+
+// DeleteConfiguration deletes the configuration stored for a module, so
+// that it is rendered again on the next reconciliation
+func (r *StateRepository) DeleteConfiguration(module string) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Delete([]byte(module))
+	})
+	return err
+}
+
+// ConfigurationOverride :
+func (r *StateRepository) ConfigurationOverride() (*structs.ConfigurationOverride, error) {
+
+	var override *structs.ConfigurationOverride
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+
+		data := b.Get(overrideObjectKey)
+		if data != nil {
+			override = &structs.ConfigurationOverride{}
+			if err := decode(data, override); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return override, err
+}
+
+// SetConfigurationOverride :
+func (r *StateRepository) SetConfigurationOverride(o *structs.ConfigurationOverride) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Put(overrideObjectKey, encode(o))
+	})
+	return err
+}
+
+// DeleteConfigurationOverride :
+func (r *StateRepository) DeleteConfigurationOverride() error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Delete(overrideObjectKey)
+	})
+	return err
+}
+
+// PendingConfiguration :
+func (r *StateRepository) PendingConfiguration() (*structs.PendingConfiguration, error) {
+
+	var pending *structs.PendingConfiguration
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+
+		data := b.Get(pendingObjectKey)
+		if data != nil {
+			pending = &structs.PendingConfiguration{}
+			if err := decode(data, pending); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return pending, err
+}
+
+// SetPendingConfiguration :
+func (r *StateRepository) SetPendingConfiguration(p *structs.PendingConfiguration) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Put(pendingObjectKey, encode(p))
+	})
+	return err
+}
+
+// DeletePendingConfiguration :
+func (r *StateRepository) DeletePendingConfiguration() error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName)
+		return b.Delete(pendingObjectKey)
+	})
+	return err
+}
+
+// ConfigurationChanges returns the configuration changes
+// recorded for a module, from the oldest to the newest.
+func (r *StateRepository) ConfigurationChanges(module string) ([]*structs.ConfigurationChange, error) {
+
+	changes := []*structs.ConfigurationChange{}
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, changesBucketName, []byte(module))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			change := &structs.ConfigurationChange{}
+			if err := decode(v, change); err != nil {
+				return err
+			}
+			changes = append(changes, change)
+			return nil
+		})
+	})
+
+	return changes, err
+}
+
+// AddConfigurationChange :
+func (r *StateRepository) AddConfigurationChange(c *structs.ConfigurationChange) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(changesBucketName).CreateBucketIfNotExists([]byte(c.Module))
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		if err := b.Put(itob(seq), encode(c)); err != nil {
+			return err
+		}
+
+		return truncate(b, maxConfigurationChanges)
+	})
+	return err
+}
+
+// ConfigurationVersions returns the configuration versions
+// stored for a module, from the oldest to the newest.
+func (r *StateRepository) ConfigurationVersions(module string) ([]*structs.ConfigurationVersion, error) {
+
+	versions := []*structs.ConfigurationVersion{}
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, configurationBucketName, historyBucketName, []byte(module))
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			version := &structs.ConfigurationVersion{}
+			if err := decode(v, version); err != nil {
+				return err
+			}
+			versions = append(versions, version)
+			return nil
+		})
+	})
+
+	return versions, err
+}
+
+// ConfigurationVersion :
+func (r *StateRepository) ConfigurationVersion(module string, version uint64) (*structs.ConfigurationVersion, error) {
+
+	var v *structs.ConfigurationVersion
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, configurationBucketName, historyBucketName, []byte(module))
+		if b == nil {
+			return structs.ErrNotFound
+		}
+
+		data := b.Get(itob(version))
+		if data == nil {
+			return structs.ErrNotFound
+		}
+
+		v = &structs.ConfigurationVersion{}
+		return decode(data, v)
+	})
+
+	return v, err
+}
+
+// AddConfigurationVersion stores a new configuration version, assigning
+// it a version number and keeping at most the latest keep versions.
+func (r *StateRepository) AddConfigurationVersion(v *structs.ConfigurationVersion, keep int) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(configurationBucketName).Bucket(historyBucketName).CreateBucketIfNotExists([]byte(v.Module))
+		if err != nil {
+			return err
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		v.Version = seq
+
+		if err := b.Put(itob(seq), encode(v)); err != nil {
+			return err
+		}
+
+		return truncate(b, keep)
+	})
+	return err
+}
+
+// ConfigurationPin :
+func (r *StateRepository) ConfigurationPin(module string) (*structs.ConfigurationPin, error) {
+
+	var pin *structs.ConfigurationPin
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, configurationBucketName, pinsBucketName)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(module))
+		if data != nil {
+			pin = &structs.ConfigurationPin{}
+			if err := decode(data, pin); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return pin, err
+}
+
+// SetConfigurationPin :
+func (r *StateRepository) SetConfigurationPin(p *structs.ConfigurationPin) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName).Bucket(pinsBucketName)
+		return b.Put([]byte(p.Module), encode(p))
+	})
+	return err
+}
+
+// DeleteConfigurationPin :
+func (r *StateRepository) DeleteConfigurationPin(module string) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(configurationBucketName).Bucket(pinsBucketName)
+		return b.Delete([]byte(module))
+	})
+	return err
+}
+
+// FileChecksum returns the checksum of a file as last rendered by the
+// client, or an empty string if the file was never rendered.
+func (r *StateRepository) FileChecksum(path string) (string, error) {
+
+	var checksum string
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, configurationBucketName, checksumsBucketName)
+		if b == nil {
+			return nil
+		}
+		checksum = string(b.Get([]byte(path)))
+		return nil
+	})
+
+	return checksum, err
+}
+
+// SetFileChecksum :
+func (r *StateRepository) SetFileChecksum(path string, checksum string) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := nestedBucket(tx, configurationBucketName, checksumsBucketName)
+		return b.Put([]byte(path), []byte(checksum))
+	})
+	return err
+}
+
+// ModuleStatuses returns the persisted reconciliation status of each module
+func (r *StateRepository) ModuleStatuses() ([]*structs.ModuleStatus, error) {
+
+	statuses := []*structs.ModuleStatus{}
+
+	err := r.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modulesBucketName)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			s := &structs.ModuleStatus{}
+			if err := decode(v, s); err != nil {
+				return err
+			}
+			statuses = append(statuses, s)
+			return nil
+		})
+	})
+
+	return statuses, err
+}
+
+// SetModuleStatus :
+func (r *StateRepository) SetModuleStatus(s *structs.ModuleStatus) error {
+	err := r.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(modulesBucketName)
+		return b.Put([]byte(s.Name), encode(s))
+	})
+	return err
+}
+
+// view runs fn within the transaction the repository is bound to,
+// or within a new read-only transaction otherwise
+func (r *StateRepository) view(fn func(tx *bolt.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	return r.db.View(fn)
+}
+
+// update runs fn within the transaction the repository is bound to,
+// or within a new read-write transaction otherwise
+func (r *StateRepository) update(fn func(tx *bolt.Tx) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	return r.db.Update(fn)
+}
+
+// nestedBucket returns the bucket found by following the path of
+// bucket names passed as argument, or nil if it does not exist.
+func nestedBucket(tx *bolt.Tx, names ...[]byte) *bolt.Bucket {
+
+	b := tx.Bucket(names[0])
+
+	for _, name := range names[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+
+	return b
+}
+
+// truncate deletes the oldest keys from a bucket so
+// that at most max keys are kept.
+func truncate(b *bolt.Bucket, max int) error {
+
+	keys := [][]byte{}
+
+	cur := b.Cursor()
+	for k, _ := cur.First(); k != nil; k, _ = cur.Next() {
+		keys = append(keys, append([]byte{}, k...))
+	}
+
+	if len(keys) <= max {
+		return nil
+	}
+
+	for _, k := range keys[:len(keys)-max] {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// itob returns an 8-byte big endian representation of v,
+// so that keys created from sequences are sorted
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
+
 func encode(in interface{}) []byte {
 	out, err := json.Marshal(in)
 	if err != nil {
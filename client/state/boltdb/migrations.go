@@ -0,0 +1,269 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/seashell/agent/pkg/log"
+	"github.com/seashell/agent/seashell/structs"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucketName         = []byte("meta")
+	schemaVersionObjectKey = []byte("schema_version")
+)
+
+// migration upgrades the state DB from the previous schema version
+// to version. Migrations must be idempotent, since databases created
+// before schema versioning was introduced are migrated from version 0
+// regardless of the buckets they already contain.
+type migration struct {
+	version     uint64
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+// migrations contains all schema migrations, in order. The version of
+// the last migration is the schema version written by this binary.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create configuration, change history and pin buckets",
+		migrate: func(tx *bolt.Tx) error {
+			for _, name := range [][]byte{configurationBucketName, changesBucketName} {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			// Configuration history and pins are kept in nested
+			// buckets within the configuration bucket
+			b := tx.Bucket(configurationBucketName)
+			for _, name := range [][]byte{historyBucketName, pinsBucketName} {
+				if _, err := b.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version:     2,
+		description: "create file checksum and module status buckets",
+		migrate: func(tx *bolt.Tx) error {
+			if _, err := tx.CreateBucketIfNotExists(modulesBucketName); err != nil {
+				return err
+			}
+			_, err := tx.Bucket(configurationBucketName).CreateBucketIfNotExists(checksumsBucketName)
+			return err
+		},
+	},
+	{
+		version:     3,
+		description: "store nomad and consul retry_join addresses as lists",
+		migrate: func(tx *bolt.Tx) error {
+			for _, key := range [][]byte{nomadConfigurationObjectKey, consulConfigurationObjectKey} {
+
+				b := tx.Bucket(configurationBucketName)
+				if err := migrateRetryJoin(b, key); err != nil {
+					return err
+				}
+
+				// Versions in the configuration history are rolled back to,
+				// so they are rewritten as well
+				h := nestedBucket(tx, configurationBucketName, historyBucketName, key)
+				if h == nil {
+					continue
+				}
+
+				err := h.ForEach(func(k, data []byte) error {
+					v := &structs.ConfigurationVersion{}
+					if err := decode(data, v); err != nil {
+						return err
+					}
+					config, err := retryJoinList(v.Configuration)
+					if err != nil || config == nil {
+						return err
+					}
+					v.Configuration = config
+					return h.Put(k, encode(v))
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// migrateRetryJoin rewrites the configuration stored under key, in case
+// its retry_join address is a single string rather than a list
+func migrateRetryJoin(b *bolt.Bucket, key []byte) error {
+
+	data := b.Get(key)
+	if data == nil {
+		return nil
+	}
+
+	out, err := retryJoinList(data)
+	if err != nil || out == nil {
+		return err
+	}
+
+	return b.Put(key, out)
+}
+
+// retryJoinList converts the RetryJoin field of an encoded configuration
+// from a single address, which may be empty, to a list of addresses. It
+// returns nil in case the configuration does not need to be converted.
+func retryJoinList(data []byte) ([]byte, error) {
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	// Lists and null values are kept as is
+	raw := fields["RetryJoin"]
+	if len(raw) == 0 || raw[0] != '"' {
+		return nil, nil
+	}
+
+	var addr string
+	if err := json.Unmarshal(raw, &addr); err != nil {
+		return nil, err
+	}
+
+	addrs := []string{}
+	if addr != "" {
+		addrs = append(addrs, addr)
+	}
+
+	fields["RetryJoin"] = encode(addrs)
+
+	return encode(fields), nil
+}
+
+// SchemaVersion returns the state schema version written by this binary
+func SchemaVersion() uint64 {
+	return migrations[len(migrations)-1].version
+}
+
+// schemaVersion returns the schema version stored in the DB, which
+// is 0 for databases created before schema versioning was introduced.
+func schemaVersion(tx *bolt.Tx) uint64 {
+
+	b := tx.Bucket(metaBucketName)
+	if b == nil {
+		return 0
+	}
+
+	v := b.Get(schemaVersionObjectKey)
+	if len(v) != 8 {
+		return 0
+	}
+
+	return btoi(v)
+}
+
+// isEmpty returns true if the DB contains no buckets, i.e. it was just created
+func isEmpty(tx *bolt.Tx) bool {
+	empty := true
+	tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		empty = false
+		return nil
+	})
+	return empty
+}
+
+// migrate runs the pending schema migrations in order. Before migrating
+// an existing DB, a copy of it is stored next to it as a backup. Databases
+// with a schema newer than the one supported by this binary are refused.
+func migrate(db *bolt.DB, path string, logger log.Logger) error {
+
+	var current uint64
+	var empty bool
+
+	err := db.View(func(tx *bolt.Tx) error {
+		current, empty = schemaVersion(tx), isEmpty(tx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := SchemaVersion()
+
+	if current > latest {
+		return fmt.Errorf("state schema version %d is newer than the supported version %d, please upgrade the agent", current, latest)
+	}
+
+	if current == latest {
+		return nil
+	}
+
+	if !empty {
+		backup := backupPath(path, current)
+		logger.Infof("backing up client state to %s before migrating it", backup)
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(backup, 0600)
+		})
+		if err != nil {
+			return fmt.Errorf("could not back up client state: %v", err)
+		}
+	}
+
+	// All migrations run in a single transaction, so that
+	// a failed migration leaves the DB untouched
+	return db.Update(func(tx *bolt.Tx) error {
+
+		for _, m := range migrations {
+			if m.version <= current {
+				continue
+			}
+
+			if !empty {
+				logger.Infof("migrating client state to schema version %d: %s", m.version, m.description)
+			}
+
+			if err := m.migrate(tx); err != nil {
+				return fmt.Errorf("error migrating client state to schema version %d: %v", m.version, err)
+			}
+		}
+
+		b, err := tx.CreateBucketIfNotExists(metaBucketName)
+		if err != nil {
+			return err
+		}
+
+		return b.Put(schemaVersionObjectKey, itob(latest))
+	})
+}
+
+// checkSchemaVersion returns an error unless the DB, which is opened
+// read-only and therefore cannot be migrated, has the latest schema
+func checkSchemaVersion(db *bolt.DB) error {
+
+	var current uint64
+
+	err := db.View(func(tx *bolt.Tx) error {
+		current = schemaVersion(tx)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if latest := SchemaVersion(); current != latest {
+		return fmt.Errorf("state schema version %d differs from the supported version %d", current, latest)
+	}
+
+	return nil
+}
+
+// backupPath returns the path of the backup of the
+// state DB at path taken at a given schema version
+func backupPath(path string, version uint64) string {
+	return fmt.Sprintf("%s.v%d.bak", path, version)
+}
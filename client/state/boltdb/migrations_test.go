@@ -0,0 +1,346 @@
+package boltdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	simple "github.com/seashell/agent/pkg/log/simple"
+	structs "github.com/seashell/agent/seashell/structs"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fixtures are state DBs written by earlier versions of the agent
+var fixtures = []struct {
+	name    string
+	version uint64
+
+	// history indicates whether the DB contains the configuration
+	// history, files and runtime modules, besides the baseline modules
+	history bool
+}{
+	// Written by the baseline agent, which stored a single retry_join address
+	{name: "client.v0.state", version: 0},
+	// Written before schema versioning was introduced
+	{name: "client.v0-history.state", version: 0, history: true},
+	// Upgraded from the baseline, keeping its retry_join addresses
+	{name: "client.v2.state", version: 2, history: true},
+	{name: "client.v3.state", version: 3, history: true},
+}
+
+// testState copies a fixture DB to a temporary directory, and returns its path
+func testState(t *testing.T, name string) string {
+	t.Helper()
+
+	buf, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "client.state")
+	if err := ioutil.WriteFile(path, buf, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testOpen(t *testing.T, path string) (*StateRepository, error) {
+	t.Helper()
+
+	logger, err := simple.NewLoggerAdapter(simple.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return OpenStateRepository(path, time.Second, logger)
+}
+
+// storedSchemaVersion returns the schema version of the DB at path
+func storedSchemaVersion(t *testing.T, path string) uint64 {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	return dbSchemaVersion(db)
+}
+
+func dbSchemaVersion(db *bolt.DB) uint64 {
+
+	var v uint64
+	db.View(func(tx *bolt.Tx) error {
+		v = schemaVersion(tx)
+		return nil
+	})
+
+	return v
+}
+
+// rawConfiguration returns the configuration of a module as stored in the DB
+func rawConfiguration(db *bolt.DB, module string) string {
+
+	var out string
+	db.View(func(tx *bolt.Tx) error {
+		out = string(tx.Bucket(configurationBucketName).Get([]byte(module)))
+		return nil
+	})
+
+	return out
+}
+
+// rawFileConfiguration returns the configuration of a module as stored in the DB at path
+func rawFileConfiguration(t *testing.T, path string, module string) string {
+	t.Helper()
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	return rawConfiguration(db, module)
+}
+
+func TestMigrate(t *testing.T) {
+
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+
+			repo, err := testOpen(t, testState(t, f.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer repo.Close()
+
+			if got := dbSchemaVersion(repo.db); got != SchemaVersion() {
+				t.Fatalf("unexpected schema version %d", got)
+			}
+
+			// Existing configurations are kept, and all of them can be decoded
+			drago, err := repo.DragoConfiguration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if drago == nil || drago.Name != "edge-01" || drago.Secret != "drago-secret" {
+				t.Fatalf("unexpected drago configuration: %+v", drago)
+			}
+
+			nomad, err := repo.NomadConfiguration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nomad == nil || nomad.DataDir != "/var/lib/nomad" || !reflect.DeepEqual(nomad.RetryJoin, structs.JoinAddresses{"10.1.0.1:4647"}) {
+				t.Fatalf("unexpected nomad configuration: %+v", nomad)
+			}
+
+			consul, err := repo.ConsulConfiguration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if consul == nil || consul.DataDir != "/var/lib/consul" || len(consul.RetryJoin) != 0 {
+				t.Fatalf("unexpected consul configuration: %+v", consul)
+			}
+
+			// Retry join addresses are stored as lists
+			if raw := rawConfiguration(repo.db, "nomad"); !strings.Contains(raw, `"RetryJoin":["10.1.0.1:4647"]`) {
+				t.Fatalf("retry_join not migrated: %s", raw)
+			}
+
+			files, err := repo.FilesConfiguration()
+			if err != nil {
+				t.Fatal(err)
+			}
+			runtime, err := repo.ContainerRuntimeConfiguration()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if f.history {
+				if files == nil || len(files.Files) != 1 || files.Files[0].Path != "/etc/motd" {
+					t.Fatalf("unexpected files configuration: %+v", files)
+				}
+				if runtime == nil || runtime.LogDriver != "journald" {
+					t.Fatalf("unexpected runtime configuration: %+v", runtime)
+				}
+
+				pin, err := repo.ConfigurationPin("drago")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if pin == nil || pin.Version != 1 {
+					t.Fatalf("unexpected pin: %+v", pin)
+				}
+			}
+
+			// Versions in the history can still be rolled back to
+			versions, err := repo.ConfigurationVersions("nomad")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range versions {
+				config := &structs.NomadConfiguration{}
+				if err := json.Unmarshal(v.Configuration, config); err != nil {
+					t.Fatal(err)
+				}
+				if len(config.RetryJoin) != 1 {
+					t.Fatalf("unexpected nomad configuration version: %s", v.Configuration)
+				}
+			}
+
+			// Buckets created by the migrations can be used
+			err = repo.Update(func(tx state.Transaction) error {
+				if err := tx.AddConfigurationVersion(&structs.ConfigurationVersion{Module: "drago"}, 10); err != nil {
+					return err
+				}
+				if err := tx.SetConfigurationPin(&structs.ConfigurationPin{Module: "consul", Version: 1}); err != nil {
+					return err
+				}
+				if err := tx.SetFileChecksum("/etc/drago.hcl", "abc"); err != nil {
+					return err
+				}
+				return tx.SetModuleStatus(&structs.ModuleStatus{Name: "drago"})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMigrate_Backup(t *testing.T) {
+
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+
+			path := testState(t, f.name)
+
+			repo, err := testOpen(t, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo.Close()
+
+			// DBs already at the latest version are not backed up
+			if f.version == SchemaVersion() {
+				if matches, _ := filepath.Glob(path + ".v*.bak"); len(matches) != 0 {
+					t.Fatalf("unexpected backups %v", matches)
+				}
+				return
+			}
+
+			backup := backupPath(path, f.version)
+			if backup != fmt.Sprintf("%s.v%d.bak", path, f.version) {
+				t.Fatalf("unexpected backup path %s", backup)
+			}
+
+			if got := storedSchemaVersion(t, backup); got != f.version {
+				t.Fatalf("unexpected backup schema version %d", got)
+			}
+
+			// The backup contains the configurations as they were before migrating
+			if got, expected := rawFileConfiguration(t, backup, "nomad"), rawFileConfiguration(t, filepath.Join("testdata", f.name), "nomad"); got != expected {
+				t.Fatalf("unexpected nomad configuration in backup: %s", got)
+			}
+		})
+	}
+}
+
+func TestMigrate_Empty(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "client.state")
+
+	repo, err := testOpen(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	if got := storedSchemaVersion(t, path); got != SchemaVersion() {
+		t.Fatalf("unexpected schema version %d", got)
+	}
+
+	if matches, _ := filepath.Glob(path + ".v*.bak"); len(matches) != 0 {
+		t.Fatalf("new DB backed up: %v", matches)
+	}
+}
+
+func TestMigrate_NewerSchema(t *testing.T) {
+
+	path := testState(t, fixtures[len(fixtures)-1].name)
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucketName).Put(schemaVersionObjectKey, itob(SchemaVersion()+1))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testOpen(t, path)
+	if err == nil || !strings.Contains(err.Error(), "newer than the supported version") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := storedSchemaVersion(t, path); got != SchemaVersion()+1 {
+		t.Fatalf("schema version modified to %d", got)
+	}
+
+	if matches, _ := filepath.Glob(path + ".v*.bak"); len(matches) != 0 {
+		t.Fatalf("unexpected backups %v", matches)
+	}
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+
+	logger, err := simple.NewLoggerAdapter(simple.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only DBs cannot be migrated, so outdated ones are refused
+	_, err = NewReadOnlyStateRepository(testState(t, fixtures[0].name), time.Second, logger)
+	if err == nil || !strings.Contains(err.Error(), "differs from the supported version") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo, err := NewReadOnlyStateRepository(testState(t, fixtures[len(fixtures)-1].name), time.Second, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+}
+
+func TestRetryJoinList(t *testing.T) {
+
+	cases := map[string]string{
+		`{"Name":"a","RetryJoin":""}`:           `{"Name":"a","RetryJoin":[]}`,
+		`{"Name":"a","RetryJoin":"10.1.0.1"}`:   `{"Name":"a","RetryJoin":["10.1.0.1"]}`,
+		`{"Name":"a","RetryJoin":["10.1.0.1"]}`: "",
+		`{"Name":"a","RetryJoin":null}`:         "",
+		`{"Name":"a"}`:                          "",
+	}
+
+	for in, expected := range cases {
+		out, err := retryJoinList([]byte(in))
+		if err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if string(out) != expected {
+			t.Errorf("%s: converted to %s, expected %q", in, out, expected)
+		}
+	}
+}
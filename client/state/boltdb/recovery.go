@@ -0,0 +1,132 @@
+package boltdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// ErrCorrupted is returned when opening a state DB which is corrupted
+	ErrCorrupted = errors.New("state DB is corrupted")
+
+	// ErrLocked is returned when the lock of a state DB cannot be
+	// obtained within the timeout, e.g. because it is held by a running agent
+	ErrLocked = errors.New("state DB is locked")
+)
+
+// open opens the DB at path, returning ErrCorrupted in case its
+// file is not a valid BoltDB file, or it fails the consistency check.
+func open(path string, options *bolt.Options) (db *bolt.DB, err error) {
+
+	// Corrupted pages may cause BoltDB to panic rather than fail
+	defer func() {
+		if r := recover(); r != nil {
+			if db != nil {
+				db.Close()
+			}
+			db, err = nil, fmt.Errorf("%w: %v", ErrCorrupted, r)
+		}
+	}()
+
+	db, err = bolt.Open(path, 0666, options)
+	if err != nil {
+		switch err {
+		case bolt.ErrTimeout:
+			return nil, fmt.Errorf("%w: %v", ErrLocked, err)
+		case bolt.ErrInvalid, bolt.ErrVersionMismatch, bolt.ErrChecksum:
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	return db, nil
+}
+
+// Backup stores a copy of the repository next to its file, which
+// is the most recent backup until the next one is taken.
+func (r *StateRepository) Backup() error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(r.db.Path()+".bak", 0600)
+	})
+}
+
+// MoveAside renames the state DB at path, e.g. because it is
+// corrupted, so that a new one can be created in its place.
+// It returns the path to which the DB was moved.
+func MoveAside(path string) (string, error) {
+
+	dst := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+
+	if err := os.Rename(path, dst); err != nil {
+		return "", err
+	}
+
+	return dst, nil
+}
+
+// LatestBackup returns the most recent backup of the state DB at path,
+// either taken on startup or before a migration, or an empty string
+// in case there are no backups.
+func LatestBackup(path string) (string, error) {
+
+	matches, err := filepath.Glob(path + "*.bak")
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	var latestTime time.Time
+
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest, latestTime = m, info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// RestoreBackup copies a backup to path, where
+// the state DB must not exist anymore
+func RestoreBackup(backup, path string) error {
+
+	src, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return dst.Close()
+}
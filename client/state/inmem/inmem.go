@@ -0,0 +1,523 @@
+package inmem
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/seashell/agent/client/state"
+	"github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	// maxConfigurationChanges is the number of configuration changes
+	// kept for each module, after which the oldest ones are discarded.
+	maxConfigurationChanges = 100
+)
+
+const (
+	dragoConfigurationObjectKey   = "drago"
+	nomadConfigurationObjectKey   = "nomad"
+	consulConfigurationObjectKey  = "consul"
+	filesConfigurationObjectKey   = "files"
+	runtimeConfigurationObjectKey = "runtime"
+	overrideObjectKey             = "override"
+	pendingObjectKey              = "pending"
+)
+
+// StateRepository is a state repository kept in memory, which is lost
+// once the client stops. Objects are stored encoded, as in the BoltDB
+// repository, so that callers never share them with the repository.
+type StateRepository struct {
+	store *store
+
+	// tx is the copy of the data modified within a transaction,
+	// in case the repository is bound to one
+	tx *data
+}
+
+// store holds the current data, which is replaced
+// as a whole when a transaction is committed
+type store struct {
+	lock sync.RWMutex
+	data *data
+}
+
+type data struct {
+	objects   map[string][]byte
+	changes   map[string]*sequence
+	history   map[string]*sequence
+	pins      map[string][]byte
+	checksums map[string]string
+	modules   map[string][]byte
+}
+
+// sequence is a list of values keyed by increasing
+// numbers, similar to a BoltDB bucket with a sequence
+type sequence struct {
+	last    uint64
+	entries []*entry
+}
+
+type entry struct {
+	key   uint64
+	value []byte
+}
+
+// NewStateRepository creates a new in-memory state repository
+func NewStateRepository() *StateRepository {
+	return &StateRepository{
+		store: &store{
+			data: &data{
+				objects:   map[string][]byte{},
+				changes:   map[string]*sequence{},
+				history:   map[string]*sequence{},
+				pins:      map[string][]byte{},
+				checksums: map[string]string{},
+				modules:   map[string][]byte{},
+			},
+		},
+	}
+}
+
+// Name :
+func (r *StateRepository) Name() string {
+	return "inmem"
+}
+
+// Update runs fn over a copy of the data, which replaces
+// the data of the repository in case fn returns nil.
+func (r *StateRepository) Update(fn func(tx state.Transaction) error) error {
+
+	// Updates nested within a transaction are part of it
+	if r.tx != nil {
+		return fn(r)
+	}
+
+	r.store.lock.Lock()
+	defer r.store.lock.Unlock()
+
+	tx := r.store.data.clone()
+
+	if err := fn(&StateRepository{store: r.store, tx: tx}); err != nil {
+		return err
+	}
+
+	r.store.data = tx
+
+	return nil
+}
+
+// view runs fn over the data of the transaction the
+// repository is bound to, or over the current data otherwise
+func (r *StateRepository) view(fn func(d *data) error) error {
+	if r.tx != nil {
+		return fn(r.tx)
+	}
+	r.store.lock.RLock()
+	defer r.store.lock.RUnlock()
+	return fn(r.store.data)
+}
+
+// update runs fn over the data of the transaction the repository is
+// bound to, or within a new transaction otherwise
+func (r *StateRepository) update(fn func(d *data) error) error {
+	return r.Update(func(tx state.Transaction) error {
+		return fn(tx.(*StateRepository).tx)
+	})
+}
+
+// DragoConfiguration :
+func (r *StateRepository) DragoConfiguration() (*structs.DragoConfiguration, error) {
+	var config *structs.DragoConfiguration
+	err := r.getObject(dragoConfigurationObjectKey, func(data []byte) error {
+		config = &structs.DragoConfiguration{}
+		return decode(data, config)
+	})
+	return config, err
+}
+
+// SetDragoConfiguration :
+func (r *StateRepository) SetDragoConfiguration(c *structs.DragoConfiguration) error {
+	return r.setObject(dragoConfigurationObjectKey, c)
+}
+
+// NomadConfiguration :
+func (r *StateRepository) NomadConfiguration() (*structs.NomadConfiguration, error) {
+	var config *structs.NomadConfiguration
+	err := r.getObject(nomadConfigurationObjectKey, func(data []byte) error {
+		config = &structs.NomadConfiguration{}
+		return decode(data, config)
+	})
+	return config, err
+}
+
+// SetNomadConfiguration :
+func (r *StateRepository) SetNomadConfiguration(c *structs.NomadConfiguration) error {
+	return r.setObject(nomadConfigurationObjectKey, c)
+}
+
+// ConsulConfiguration :
+func (r *StateRepository) ConsulConfiguration() (*structs.ConsulConfiguration, error) {
+	var config *structs.ConsulConfiguration
+	err := r.getObject(consulConfigurationObjectKey, func(data []byte) error {
+		config = &structs.ConsulConfiguration{}
+		return decode(data, config)
+	})
+	return config, err
+}
+
+// SetConsulConfiguration :
+func (r *StateRepository) SetConsulConfiguration(c *structs.ConsulConfiguration) error {
+	return r.setObject(consulConfigurationObjectKey, c)
+}
+
+// FilesConfiguration :
+func (r *StateRepository) FilesConfiguration() (*structs.FilesConfiguration, error) {
+	var config *structs.FilesConfiguration
+	err := r.getObject(filesConfigurationObjectKey, func(data []byte) error {
+		config = &structs.FilesConfiguration{}
+		return decode(data, config)
+	})
+	return config, err
+}
+
+// SetFilesConfiguration :
+func (r *StateRepository) SetFilesConfiguration(c *structs.FilesConfiguration) error {
+	return r.setObject(filesConfigurationObjectKey, c)
+}
+
+// ContainerRuntimeConfiguration :
+func (r *StateRepository) ContainerRuntimeConfiguration() (*structs.ContainerRuntimeConfiguration, error) {
+	var config *structs.ContainerRuntimeConfiguration
+	err := r.getObject(runtimeConfigurationObjectKey, func(data []byte) error {
+		config = &structs.ContainerRuntimeConfiguration{}
+		return decode(data, config)
+	})
+	return config, err
+}
+
+// SetContainerRuntimeConfiguration :
+func (r *StateRepository) SetContainerRuntimeConfiguration(c *structs.ContainerRuntimeConfiguration) error {
+	return r.setObject(runtimeConfigurationObjectKey, c)
+}
+
+// DeleteConfiguration deletes the configuration stored for a module, so
+// that it is rendered again on the next reconciliation
+func (r *StateRepository) DeleteConfiguration(module string) error {
+	return r.update(func(d *data) error {
+		delete(d.objects, module)
+		return nil
+	})
+}
+
+// ConfigurationOverride :
+func (r *StateRepository) ConfigurationOverride() (*structs.ConfigurationOverride, error) {
+	var override *structs.ConfigurationOverride
+	err := r.getObject(overrideObjectKey, func(data []byte) error {
+		override = &structs.ConfigurationOverride{}
+		return decode(data, override)
+	})
+	return override, err
+}
+
+// SetConfigurationOverride :
+func (r *StateRepository) SetConfigurationOverride(o *structs.ConfigurationOverride) error {
+	return r.setObject(overrideObjectKey, o)
+}
+
+// DeleteConfigurationOverride :
+func (r *StateRepository) DeleteConfigurationOverride() error {
+	return r.update(func(d *data) error {
+		delete(d.objects, overrideObjectKey)
+		return nil
+	})
+}
+
+// PendingConfiguration :
+func (r *StateRepository) PendingConfiguration() (*structs.PendingConfiguration, error) {
+	var pending *structs.PendingConfiguration
+	err := r.getObject(pendingObjectKey, func(data []byte) error {
+		pending = &structs.PendingConfiguration{}
+		return decode(data, pending)
+	})
+	return pending, err
+}
+
+// SetPendingConfiguration :
+func (r *StateRepository) SetPendingConfiguration(p *structs.PendingConfiguration) error {
+	return r.setObject(pendingObjectKey, p)
+}
+
+// DeletePendingConfiguration :
+func (r *StateRepository) DeletePendingConfiguration() error {
+	return r.update(func(d *data) error {
+		delete(d.objects, pendingObjectKey)
+		return nil
+	})
+}
+
+// ConfigurationChanges :
+func (r *StateRepository) ConfigurationChanges(module string) ([]*structs.ConfigurationChange, error) {
+
+	changes := []*structs.ConfigurationChange{}
+
+	err := r.view(func(d *data) error {
+		s, ok := d.changes[module]
+		if !ok {
+			return nil
+		}
+		for _, e := range s.entries {
+			change := &structs.ConfigurationChange{}
+			if err := decode(e.value, change); err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+
+	return changes, err
+}
+
+// AddConfigurationChange :
+func (r *StateRepository) AddConfigurationChange(c *structs.ConfigurationChange) error {
+	return r.update(func(d *data) error {
+		s := d.sequence(d.changes, c.Module)
+		s.add(encode(c))
+		s.truncate(maxConfigurationChanges)
+		return nil
+	})
+}
+
+// ConfigurationVersions returns the configuration versions
+// stored for a module, from the oldest to the newest.
+func (r *StateRepository) ConfigurationVersions(module string) ([]*structs.ConfigurationVersion, error) {
+
+	versions := []*structs.ConfigurationVersion{}
+
+	err := r.view(func(d *data) error {
+		s, ok := d.history[module]
+		if !ok {
+			return nil
+		}
+		for _, e := range s.entries {
+			version := &structs.ConfigurationVersion{}
+			if err := decode(e.value, version); err != nil {
+				return err
+			}
+			versions = append(versions, version)
+		}
+		return nil
+	})
+
+	return versions, err
+}
+
+// ConfigurationVersion :
+func (r *StateRepository) ConfigurationVersion(module string, version uint64) (*structs.ConfigurationVersion, error) {
+
+	var v *structs.ConfigurationVersion
+
+	err := r.view(func(d *data) error {
+		s, ok := d.history[module]
+		if !ok {
+			return structs.ErrNotFound
+		}
+		for _, e := range s.entries {
+			if e.key == version {
+				v = &structs.ConfigurationVersion{}
+				return decode(e.value, v)
+			}
+		}
+		return structs.ErrNotFound
+	})
+
+	return v, err
+}
+
+// AddConfigurationVersion stores a new configuration version, assigning
+// it a version number and keeping at most the latest keep versions.
+func (r *StateRepository) AddConfigurationVersion(v *structs.ConfigurationVersion, keep int) error {
+	return r.update(func(d *data) error {
+		s := d.sequence(d.history, v.Module)
+		v.Version = s.last + 1
+		s.add(encode(v))
+		s.truncate(keep)
+		return nil
+	})
+}
+
+// ConfigurationPin :
+func (r *StateRepository) ConfigurationPin(module string) (*structs.ConfigurationPin, error) {
+
+	var pin *structs.ConfigurationPin
+
+	err := r.view(func(d *data) error {
+		if data, ok := d.pins[module]; ok {
+			pin = &structs.ConfigurationPin{}
+			return decode(data, pin)
+		}
+		return nil
+	})
+
+	return pin, err
+}
+
+// SetConfigurationPin :
+func (r *StateRepository) SetConfigurationPin(p *structs.ConfigurationPin) error {
+	return r.update(func(d *data) error {
+		d.pins[p.Module] = encode(p)
+		return nil
+	})
+}
+
+// DeleteConfigurationPin :
+func (r *StateRepository) DeleteConfigurationPin(module string) error {
+	return r.update(func(d *data) error {
+		delete(d.pins, module)
+		return nil
+	})
+}
+
+// FileChecksum returns the checksum of a file as last rendered by the
+// client, or an empty string if the file was never rendered.
+func (r *StateRepository) FileChecksum(path string) (string, error) {
+	var checksum string
+	err := r.view(func(d *data) error {
+		checksum = d.checksums[path]
+		return nil
+	})
+	return checksum, err
+}
+
+// SetFileChecksum :
+func (r *StateRepository) SetFileChecksum(path string, checksum string) error {
+	return r.update(func(d *data) error {
+		d.checksums[path] = checksum
+		return nil
+	})
+}
+
+// ModuleStatuses returns the persisted reconciliation status of each module
+func (r *StateRepository) ModuleStatuses() ([]*structs.ModuleStatus, error) {
+
+	statuses := []*structs.ModuleStatus{}
+
+	err := r.view(func(d *data) error {
+		names := make([]string, 0, len(d.modules))
+		for name := range d.modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := &structs.ModuleStatus{}
+			if err := decode(d.modules[name], s); err != nil {
+				return err
+			}
+			statuses = append(statuses, s)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
+
+// SetModuleStatus :
+func (r *StateRepository) SetModuleStatus(s *structs.ModuleStatus) error {
+	return r.update(func(d *data) error {
+		d.modules[s.Name] = encode(s)
+		return nil
+	})
+}
+
+func (r *StateRepository) getObject(key string, fn func(data []byte) error) error {
+	return r.view(func(d *data) error {
+		if data, ok := d.objects[key]; ok {
+			return fn(data)
+		}
+		return nil
+	})
+}
+
+func (r *StateRepository) setObject(key string, in interface{}) error {
+	return r.update(func(d *data) error {
+		d.objects[key] = encode(in)
+		return nil
+	})
+}
+
+// clone returns a copy of the data which can be modified without
+// affecting the original. Encoded values are never modified in
+// place, and are therefore shared between copies.
+func (d *data) clone() *data {
+	return &data{
+		objects:   cloneBytesMap(d.objects),
+		changes:   cloneSequences(d.changes),
+		history:   cloneSequences(d.history),
+		pins:      cloneBytesMap(d.pins),
+		checksums: cloneStringMap(d.checksums),
+		modules:   cloneBytesMap(d.modules),
+	}
+}
+
+// sequence returns the sequence with the given name, creating it if needed
+func (d *data) sequence(sequences map[string]*sequence, name string) *sequence {
+	s, ok := sequences[name]
+	if !ok {
+		s = &sequence{}
+		sequences[name] = s
+	}
+	return s
+}
+
+func (s *sequence) add(value []byte) {
+	s.last++
+	s.entries = append(s.entries, &entry{key: s.last, value: value})
+}
+
+// truncate deletes the oldest entries so that at most max entries are kept
+func (s *sequence) truncate(max int) {
+	if len(s.entries) > max {
+		s.entries = s.entries[len(s.entries)-max:]
+	}
+}
+
+func cloneSequences(in map[string]*sequence) map[string]*sequence {
+	out := make(map[string]*sequence, len(in))
+	for k, s := range in {
+		out[k] = &sequence{
+			last:    s.last,
+			entries: append([]*entry{}, s.entries...),
+		}
+	}
+	return out
+}
+
+func cloneBytesMap(in map[string][]byte) map[string][]byte {
+	out := make(map[string][]byte, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func cloneStringMap(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func encode(in interface{}) []byte {
+	out, err := json.Marshal(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func decode(encoded []byte, out interface{}) error {
+	return json.Unmarshal(encoded, out)
+}
@@ -0,0 +1,203 @@
+package inmem
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	state "github.com/seashell/agent/client/state"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+func TestUpdate_Commit(t *testing.T) {
+
+	r := NewStateRepository()
+
+	err := r.Update(func(tx state.Transaction) error {
+		if err := tx.SetDragoConfiguration(&structs.DragoConfiguration{Name: "edge-01"}); err != nil {
+			return err
+		}
+		if err := tx.AddConfigurationVersion(&structs.ConfigurationVersion{Module: "drago"}, 10); err != nil {
+			return err
+		}
+		return tx.SetFileChecksum("/etc/drago.hcl", "abc")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drago, err := r.DragoConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drago == nil || drago.Name != "edge-01" {
+		t.Fatalf("unexpected drago configuration: %+v", drago)
+	}
+
+	versions, err := r.ConfigurationVersions("drago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].Version != 1 {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+
+	if checksum, _ := r.FileChecksum("/etc/drago.hcl"); checksum != "abc" {
+		t.Fatalf("unexpected checksum %q", checksum)
+	}
+}
+
+func TestUpdate_Rollback(t *testing.T) {
+
+	r := NewStateRepository()
+
+	if err := r.SetDragoConfiguration(&structs.DragoConfiguration{Name: "edge-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+
+	err := r.Update(func(tx state.Transaction) error {
+		if err := tx.SetDragoConfiguration(&structs.DragoConfiguration{Name: "edge-02"}); err != nil {
+			return err
+		}
+		if err := tx.SetConfigurationPin(&structs.ConfigurationPin{Module: "drago", Version: 1}); err != nil {
+			return err
+		}
+		if err := tx.DeleteConfiguration("nomad"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	drago, err := r.DragoConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drago == nil || drago.Name != "edge-01" {
+		t.Fatalf("drago configuration not rolled back: %+v", drago)
+	}
+
+	if pin, _ := r.ConfigurationPin("drago"); pin != nil {
+		t.Fatalf("pin not rolled back: %+v", pin)
+	}
+}
+
+func TestUpdate_Nested(t *testing.T) {
+
+	r := NewStateRepository()
+
+	failed := errors.New("failed")
+
+	err := r.Update(func(tx state.Transaction) error {
+
+		// Nested updates are part of the outer transaction
+		err := tx.(state.Repository).Update(func(tx state.Transaction) error {
+			return tx.SetNomadConfiguration(&structs.NomadConfiguration{Name: "edge-01"})
+		})
+		if err != nil {
+			return err
+		}
+
+		nomad, err := tx.NomadConfiguration()
+		if err != nil {
+			return err
+		}
+		if nomad == nil {
+			t.Error("nested update not visible within the transaction")
+		}
+
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// so they are rolled back along with it
+	if nomad, _ := r.NomadConfiguration(); nomad != nil {
+		t.Fatalf("nested update committed: %+v", nomad)
+	}
+}
+
+func TestUpdate_Isolation(t *testing.T) {
+
+	r := NewStateRepository()
+
+	done := make(chan struct{})
+
+	err := r.Update(func(tx state.Transaction) error {
+
+		if err := tx.SetConsulConfiguration(&structs.ConsulConfiguration{Name: "edge-01"}); err != nil {
+			return err
+		}
+
+		// Reads within the transaction see its uncommitted writes
+		consul, err := tx.ConsulConfiguration()
+		if err != nil {
+			return err
+		}
+		if consul == nil || consul.Name != "edge-01" {
+			t.Errorf("uncommitted write not visible within the transaction: %+v", consul)
+		}
+
+		// while reads outside of it wait for it to be committed
+		go func() {
+			defer close(done)
+			consul, err := r.ConsulConfiguration()
+			if err != nil || consul == nil || consul.Name != "edge-01" {
+				t.Errorf("unexpected consul configuration after commit: %+v, %v", consul, err)
+			}
+		}()
+
+		select {
+		case <-done:
+			t.Error("read outside of the transaction did not wait for it")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-done
+}
+
+func TestStateRepository_Clone(t *testing.T) {
+
+	r := NewStateRepository()
+
+	files := &structs.FilesConfiguration{
+		Files: []*structs.ManagedFile{{Path: "/etc/motd", Content: "hello"}},
+	}
+	if err := r.SetFilesConfiguration(files); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modifying the stored struct after setting it has no effect
+	files.Files[0].Content = "modified"
+
+	out, err := r.FilesConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Files[0].Content != "hello" {
+		t.Fatalf("stored configuration modified through the input: %+v", out.Files[0])
+	}
+
+	// nor does modifying the returned one
+	out.Files[0].Content = "modified"
+	out.Files = append(out.Files, &structs.ManagedFile{Path: "/etc/issue"})
+
+	out, err = r.FilesConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Files) != 1 || out.Files[0].Content != "hello" {
+		t.Fatalf("stored configuration modified through the output: %+v", out.Files)
+	}
+}
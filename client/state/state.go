@@ -1,22 +1,31 @@
 package state
 
 import (
-	"context"
-
 	"github.com/seashell/agent/seashell/structs"
 )
 
-// Transaction :
+// Transaction contains the operations on the client state, which
+// are applied atomically when performed within a transaction.
 type Transaction interface {
-	Commit() error
+	ConfigurationRepository
+	ChangeRepository
+	HistoryRepository
+	OverrideRepository
+	PendingConfigurationRepository
+	ChecksumRepository
+	ModuleStatusRepository
 }
 
 // Repository :
 type Repository interface {
 	Name() string
-	Transaction(ctx context.Context) Transaction
 
-	ConfigurationRepository
+	// Update runs fn within a read-write transaction, which is committed
+	// in case fn returns nil, and rolled back otherwise. Operations on the
+	// repository itself must not be performed from within fn.
+	Update(fn func(tx Transaction) error) error
+
+	Transaction
 }
 
 // ConfigurationRepository : Configuration repository interface
@@ -27,4 +36,51 @@ type ConfigurationRepository interface {
 	SetNomadConfiguration(*structs.NomadConfiguration) error
 	ConsulConfiguration() (*structs.ConsulConfiguration, error)
 	SetConsulConfiguration(*structs.ConsulConfiguration) error
+	FilesConfiguration() (*structs.FilesConfiguration, error)
+	SetFilesConfiguration(*structs.FilesConfiguration) error
+	ContainerRuntimeConfiguration() (*structs.ContainerRuntimeConfiguration, error)
+	SetContainerRuntimeConfiguration(*structs.ContainerRuntimeConfiguration) error
+	DeleteConfiguration(module string) error
+}
+
+// ChangeRepository : Configuration change history repository interface
+type ChangeRepository interface {
+	ConfigurationChanges(module string) ([]*structs.ConfigurationChange, error)
+	AddConfigurationChange(*structs.ConfigurationChange) error
+}
+
+// HistoryRepository : Configuration history repository interface
+type HistoryRepository interface {
+	ConfigurationVersions(module string) ([]*structs.ConfigurationVersion, error)
+	ConfigurationVersion(module string, version uint64) (*structs.ConfigurationVersion, error)
+	AddConfigurationVersion(v *structs.ConfigurationVersion, keep int) error
+	ConfigurationPin(module string) (*structs.ConfigurationPin, error)
+	SetConfigurationPin(*structs.ConfigurationPin) error
+	DeleteConfigurationPin(module string) error
+}
+
+// OverrideRepository : Configuration override repository interface
+type OverrideRepository interface {
+	ConfigurationOverride() (*structs.ConfigurationOverride, error)
+	SetConfigurationOverride(*structs.ConfigurationOverride) error
+	DeleteConfigurationOverride() error
+}
+
+// PendingConfigurationRepository : Pending configuration repository interface
+type PendingConfigurationRepository interface {
+	PendingConfiguration() (*structs.PendingConfiguration, error)
+	SetPendingConfiguration(*structs.PendingConfiguration) error
+	DeletePendingConfiguration() error
+}
+
+// ChecksumRepository : Rendered file checksum repository interface
+type ChecksumRepository interface {
+	FileChecksum(path string) (string, error)
+	SetFileChecksum(path string, checksum string) error
+}
+
+// ModuleStatusRepository : Module reconciliation status repository interface
+type ModuleStatusRepository interface {
+	ModuleStatuses() ([]*structs.ModuleStatus, error)
+	SetModuleStatus(*structs.ModuleStatus) error
 }
@@ -0,0 +1,566 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+const (
+	defaultUpdateReadyTimeout = 2 * time.Minute
+
+	// updateDownloadTimeout is the maximum duration of the download
+	// of the binary of a new version from each of its URLs
+	updateDownloadTimeout = 10 * time.Minute
+
+	// updateMaxStarts is the number of times a new version can start
+	// without becoming ready, e.g. because it crashes and is restarted
+	// by the service manager, before it is rolled back
+	updateMaxStarts = 3
+
+	updateDirName    = "update"
+	updateMarkerName = "update.json"
+)
+
+// updateMaxBinarySize is the maximum size of a downloaded binary
+var updateMaxBinarySize = 512 << 20
+
+// SelfUpdateConfig contains the local settings of agent self-updates
+type SelfUpdateConfig struct {
+
+	// PublicKey is the base64-encoded ed25519 public key against which
+	// updates are verified. Updates are ignored unless it is set.
+	PublicKey string
+
+	// BinaryPath is the path of the agent binary which is replaced
+	// on updates. It defaults to the running executable.
+	BinaryPath string
+
+	// ReadyTimeout is how long a new version has to become
+	// ready before the previous one is restored
+	ReadyTimeout time.Duration
+}
+
+// DefaultSelfUpdateConfig returns the default settings of agent self-updates
+func DefaultSelfUpdateConfig() *SelfUpdateConfig {
+	return &SelfUpdateConfig{
+		ReadyTimeout: defaultUpdateReadyTimeout,
+	}
+}
+
+// Merge combines two SelfUpdateConfig structs, returning the result
+func (c *SelfUpdateConfig) Merge(b *SelfUpdateConfig) *SelfUpdateConfig {
+	result := *c
+
+	if b.PublicKey != "" {
+		result.PublicKey = b.PublicKey
+	}
+	if b.BinaryPath != "" {
+		result.BinaryPath = b.BinaryPath
+	}
+	if b.ReadyTimeout != 0 {
+		result.ReadyTimeout = b.ReadyTimeout
+	}
+
+	return &result
+}
+
+// updateMarker is persisted in the state directory once the binary is
+// replaced, so that the new version can be rolled back in case it does
+// not become ready in time. It is kept after a rollback, so that the
+// version which was rolled back is not installed again.
+type updateMarker struct {
+	Version         string
+	PreviousVersion string
+	BinaryPath      string
+	BackupPath      string
+	Deadline        time.Time
+	Starts          int
+	RolledBack      bool
+	Error           string
+}
+
+// updateState keeps track of the update of the agent
+type updateState struct {
+	lock       sync.Mutex
+	inProgress bool
+	status     *structs.AgentUpdateStatus
+
+	// rolledBack is the version which was rolled back, if any
+	rolledBack string
+
+	readyOnce sync.Once
+	readyCh   chan struct{}
+}
+
+func newUpdateState() *updateState {
+	return &updateState{
+		readyCh: make(chan struct{}),
+	}
+}
+
+// AgentUpdateStatus returns the state of the latest update of the agent, if any
+func (c *Client) AgentUpdateStatus() *structs.AgentUpdateStatus {
+
+	c.update.lock.Lock()
+	defer c.update.lock.Unlock()
+
+	if c.update.status == nil {
+		return nil
+	}
+
+	status := *c.update.status
+
+	return &status
+}
+
+func (c *Client) setAgentUpdateStatus(version, previous, state string, err error) {
+
+	status := &structs.AgentUpdateStatus{
+		Version:         version,
+		PreviousVersion: previous,
+		State:           state,
+		Timestamp:       time.Now(),
+	}
+
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	c.update.lock.Lock()
+	c.update.status = status
+	c.update.lock.Unlock()
+}
+
+// markReady signals that the client completed its first reconciliation,
+// which is when a new version of the agent is considered ready
+func (c *Client) markReady() {
+	c.update.readyOnce.Do(func() {
+		close(c.update.readyCh)
+	})
+}
+
+// setupUpdate resumes the update of the agent in case it was just updated,
+// rolling it back if it already failed to become ready too many times, or
+// if its deadline passed while the agent was not running.
+func (c *Client) setupUpdate() error {
+
+	m, err := c.readUpdateMarker()
+	if err != nil || m == nil {
+		return err
+	}
+
+	current := normalizeVersion(c.config.Version.VersionNumber())
+
+	if m.RolledBack {
+		c.update.rolledBack = m.Version
+		if current == m.PreviousVersion {
+			c.setAgentUpdateStatus(m.Version, m.PreviousVersion, structs.AgentUpdateStateRolledBack, fmt.Errorf("%s", m.Error))
+		}
+		return nil
+	}
+
+	// The binary was replaced by hand, or the
+	// update was otherwise not carried out
+	if current != m.Version {
+		c.logger.Warnf("ignoring pending update to %s, as %s is running", m.Version, current)
+		return c.removeUpdateMarker()
+	}
+
+	m.Starts++
+
+	switch {
+	case m.Starts > updateMaxStarts:
+		return c.rollbackUpdate(m, fmt.Errorf("started %d times without becoming ready", m.Starts-1))
+	case time.Now().After(m.Deadline):
+		return c.rollbackUpdate(m, fmt.Errorf("did not become ready within %s", c.config.SelfUpdate.ReadyTimeout))
+	}
+
+	if err := c.writeUpdateMarker(m); err != nil {
+		return err
+	}
+
+	c.setAgentUpdateStatus(m.Version, m.PreviousVersion, structs.AgentUpdateStatePending, nil)
+
+	go c.watchUpdate(m)
+
+	return nil
+}
+
+// watchUpdate completes the update once the client is ready, or
+// rolls it back in case its deadline passes before it is.
+func (c *Client) watchUpdate(m *updateMarker) {
+
+	deadline := time.NewTimer(time.Until(m.Deadline))
+	defer deadline.Stop()
+
+	select {
+	case <-c.update.readyCh:
+
+		os.Remove(m.BackupPath)
+		os.Remove(c.downloadPath(m.Version))
+
+		if err := c.removeUpdateMarker(); err != nil {
+			c.logger.Errorf("could not remove update marker: %v", err)
+		}
+
+		c.setAgentUpdateStatus(m.Version, m.PreviousVersion, structs.AgentUpdateStateCompleted, nil)
+		c.emitEvent(structs.EventTypeInfo, "update", "agent updated from %s to %s", m.PreviousVersion, m.Version)
+
+	case <-deadline.C:
+
+		// Prevent reconciliations from running while the
+		// binary is restored and the agent is re-executed
+		c.shutdownLock.Lock()
+		defer c.shutdownLock.Unlock()
+
+		if c.shutdown {
+			return
+		}
+
+		err := c.rollbackUpdate(m, fmt.Errorf("did not become ready within %s", c.config.SelfUpdate.ReadyTimeout))
+		c.logger.Errorf("error rolling back update to %s: %v", m.Version, err)
+
+	case <-c.shutdownCh:
+	}
+}
+
+// rollbackUpdate restores the previous binary and re-executes it. It only
+// returns in case the previous binary could not be restored or executed.
+func (c *Client) rollbackUpdate(m *updateMarker, reason error) error {
+
+	c.logger.Errorf("rolling back update to %s: %v", m.Version, reason)
+
+	if err := os.Rename(m.BackupPath, m.BinaryPath); err != nil {
+		return fmt.Errorf("could not restore previous binary: %v", err)
+	}
+
+	os.Remove(c.downloadPath(m.Version))
+
+	m.RolledBack = true
+	m.Error = reason.Error()
+
+	if err := c.writeUpdateMarker(m); err != nil {
+		return err
+	}
+
+	return execBinary(m.BinaryPath)
+}
+
+// checkAgentUpdate starts updating the agent in case the sync response
+// advertises a version other than the running one. Versions which
+// were rolled back are not installed again.
+func (c *Client) checkAgentUpdate(u *structs.AgentUpdate) {
+
+	if u == nil || u.Version == "" {
+		return
+	}
+
+	version := normalizeVersion(u.Version)
+	current := normalizeVersion(c.config.Version.VersionNumber())
+
+	if version == current {
+		return
+	}
+
+	if c.config.SelfUpdate.PublicKey == "" {
+		c.logger.Debugf("ignoring update to %s, as no public key is configured", version)
+		return
+	}
+
+	// The new binary could be installed, but never executed
+	if !reexecSupported {
+		c.logger.Debugf("ignoring update to %s, as updates are not supported on this platform", version)
+		return
+	}
+
+	if !c.inMaintenanceWindow(time.Now()) {
+		c.logger.Debugf("deferring update to %s until the next maintenance window", version)
+		return
+	}
+
+	c.update.lock.Lock()
+	defer c.update.lock.Unlock()
+
+	if c.update.inProgress || c.update.rolledBack == version {
+		return
+	}
+
+	if s := c.update.status; s != nil && s.Version == version && s.State == structs.AgentUpdateStateFailed {
+		return
+	}
+
+	c.update.inProgress = true
+
+	go c.applyAgentUpdate(u)
+}
+
+// applyAgentUpdate downloads and verifies the binary of a new version,
+// replaces the running binary with it, and re-executes it. It only
+// returns in case the update fails.
+func (c *Client) applyAgentUpdate(u *structs.AgentUpdate) {
+
+	version := normalizeVersion(u.Version)
+	current := normalizeVersion(c.config.Version.VersionNumber())
+
+	defer func() {
+		c.update.lock.Lock()
+		c.update.inProgress = false
+		c.update.lock.Unlock()
+	}()
+
+	fail := func(err error) {
+		c.setAgentUpdateStatus(version, current, structs.AgentUpdateStateFailed, err)
+		c.emitEvent(structs.EventTypeError, "update", "could not update agent to %s: %v", version, err)
+	}
+
+	c.setAgentUpdateStatus(version, current, structs.AgentUpdateStateDownloading, nil)
+	c.emitEvent(structs.EventTypeInfo, "update", "updating agent from %s to %s", current, version)
+
+	if err := c.verifyAgentUpdate(u); err != nil {
+		fail(err)
+		return
+	}
+
+	binary, err := c.downloadAgentUpdate(u)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	path, err := c.binaryPath()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	// Prevent reconciliations from running while the
+	// binary is replaced and the agent is re-executed
+	c.shutdownLock.Lock()
+	defer c.shutdownLock.Unlock()
+
+	if c.shutdown {
+		return
+	}
+
+	m := &updateMarker{
+		Version:         version,
+		PreviousVersion: current,
+		BinaryPath:      path,
+		BackupPath:      path + ".old",
+		Deadline:        time.Now().Add(c.config.SelfUpdate.ReadyTimeout),
+	}
+
+	if err := installBinary(binary, m.BinaryPath, m.BackupPath); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := c.writeUpdateMarker(m); err != nil {
+		os.Rename(m.BackupPath, m.BinaryPath)
+		fail(err)
+		return
+	}
+
+	c.logger.Infof("re-executing agent %s", version)
+
+	err = execBinary(m.BinaryPath)
+
+	// The new binary could not be executed, so the previous one is restored
+	os.Rename(m.BackupPath, m.BinaryPath)
+	c.removeUpdateMarker()
+
+	fail(fmt.Errorf("could not execute new binary: %v", err))
+}
+
+// verifyAgentUpdate verifies the signature of an update
+// against the public key pinned in the configuration
+func (c *Client) verifyAgentUpdate(u *structs.AgentUpdate) error {
+
+	if err := u.Validate(); err != nil {
+		return fmt.Errorf("invalid update: %v", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(c.config.SelfUpdate.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(u.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature")
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(key), u.SignedMessage(), sig) {
+		return fmt.Errorf("signature verification failed")
+	}
+
+	return nil
+}
+
+// downloadAgentUpdate downloads the binary of an update from the first of
+// its URLs which serves a binary with the expected SHA-256 digest, and
+// stores it in the update directory within the state directory.
+func (c *Client) downloadAgentUpdate(u *structs.AgentUpdate) ([]byte, error) {
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = updateDownloadTimeout
+
+	errs := []string{}
+
+	for _, url := range u.URLs {
+
+		c.logger.Debugf("downloading agent %s from %s", u.Version, url)
+
+		binary, err := download(client, url)
+		if err == nil && checksum(binary) != strings.ToLower(u.SHA256) {
+			err = fmt.Errorf("SHA-256 digest mismatch")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+
+		dir := filepath.Join(c.config.StateDir, updateDirName)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+
+		if err := writeFileAtomic(c.downloadPath(u.Version), binary, 0700); err != nil {
+			return nil, err
+		}
+
+		return binary, nil
+	}
+
+	return nil, fmt.Errorf("download failed: %s", strings.Join(errs, "; "))
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	binary, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(updateMaxBinarySize)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(binary) > updateMaxBinarySize {
+		return nil, fmt.Errorf("binary larger than %d bytes", updateMaxBinarySize)
+	}
+
+	return binary, nil
+}
+
+// installBinary copies the binary at path to backup, and then
+// atomically replaces it with the new binary
+func installBinary(binary []byte, path, backup string) error {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(backup, current, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("could not back up binary: %v", err)
+	}
+
+	if err := writeFileAtomic(path, binary, info.Mode().Perm()|0111); err != nil {
+		return fmt.Errorf("could not replace binary: %v", err)
+	}
+
+	return nil
+}
+
+// binaryPath returns the path of the agent binary
+func (c *Client) binaryPath() (string, error) {
+
+	path := c.config.SelfUpdate.BinaryPath
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", err
+		}
+		path = exe
+	}
+
+	return filepath.EvalSymlinks(path)
+}
+
+// downloadPath returns the path to which the binary of a version is downloaded
+func (c *Client) downloadPath(version string) string {
+	return filepath.Join(c.config.StateDir, updateDirName, "seashell-"+normalizeVersion(version))
+}
+
+func (c *Client) updateMarkerPath() string {
+	return filepath.Join(c.config.StateDir, updateDirName, updateMarkerName)
+}
+
+func (c *Client) readUpdateMarker() (*updateMarker, error) {
+
+	buf, err := ioutil.ReadFile(c.updateMarkerPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	m := &updateMarker{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, fmt.Errorf("invalid update marker: %v", err)
+	}
+
+	return m, nil
+}
+
+func (c *Client) writeUpdateMarker(m *updateMarker) error {
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.updateMarkerPath()), 0700); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.updateMarkerPath(), buf, 0600)
+}
+
+func (c *Client) removeUpdateMarker() error {
+	if err := os.Remove(c.updateMarkerPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// normalizeVersion strips the leading "v" of a version, if any
+func normalizeVersion(v string) string {
+	return strings.TrimPrefix(strings.TrimSpace(v), "v")
+}
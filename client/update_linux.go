@@ -0,0 +1,16 @@
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+// reexecSupported indicates whether the agent can re-execute
+// itself, which is required to apply updates
+const reexecSupported = true
+
+// execBinary replaces the running process with the binary at path,
+// keeping its arguments and environment. It only returns on failure.
+var execBinary = func(path string) error {
+	return syscall.Exec(path, os.Args, os.Environ())
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package client
+
+import (
+	"fmt"
+)
+
+// reexecSupported indicates whether the agent can re-execute
+// itself, which is required to apply updates
+const reexecSupported = false
+
+// execBinary is only supported on Linux
+var execBinary = func(path string) error {
+	return fmt.Errorf("re-executing the agent is not supported on this platform")
+}
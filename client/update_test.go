@@ -0,0 +1,249 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	structs "github.com/seashell/agent/seashell/structs"
+	version "github.com/seashell/agent/version"
+)
+
+// testUpdateClient returns a client running version 1.0.0, which
+// verifies updates against the returned private key
+func testUpdateClient(t *testing.T) (*Client, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := testClient(t, &Config{
+		SelfUpdate: &SelfUpdateConfig{
+			PublicKey: base64.StdEncoding.EncodeToString(pub),
+		},
+	})
+	c.config.Version = &version.VersionInfo{Version: "1.0.0"}
+	t.Cleanup(func() { close(c.shutdownCh) })
+
+	return c, priv
+}
+
+// testUpdate returns an update to version 2.0.0 of the given
+// binary, downloaded from urls and signed with key
+func testUpdate(key ed25519.PrivateKey, binary []byte, urls ...string) *structs.AgentUpdate {
+
+	digest := sha256.Sum256(binary)
+
+	u := &structs.AgentUpdate{
+		Version: "2.0.0",
+		URLs:    urls,
+		SHA256:  hex.EncodeToString(digest[:]),
+	}
+	u.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, u.SignedMessage()))
+
+	return u
+}
+
+// binaryServer serves a binary under each of the given paths
+func binaryServer(t *testing.T, binaries map[string][]byte) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		b, ok := binaries[req.URL.Path]
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		rw.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestAgentUpdate_InvalidSignature(t *testing.T) {
+
+	c, _ := testUpdateClient(t)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		rw.Write([]byte("binary"))
+	}))
+	defer srv.Close()
+
+	// Signed with a key other than the configured one
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.update.inProgress = true
+	c.applyAgentUpdate(testUpdate(other, []byte("binary"), srv.URL))
+
+	status := c.AgentUpdateStatus()
+	if status == nil || status.State != structs.AgentUpdateStateFailed || status.Error != "signature verification failed" {
+		t.Fatalf("unexpected update status: %+v", status)
+	}
+	if requests != 0 {
+		t.Fatalf("binary downloaded before verifying the signature")
+	}
+	if c.update.inProgress {
+		t.Fatal("update still in progress after failing")
+	}
+}
+
+func TestAgentUpdate_DigestMismatch(t *testing.T) {
+
+	c, key := testUpdateClient(t)
+
+	binary := []byte("new binary")
+
+	srv := binaryServer(t, map[string][]byte{
+		"/tampered": []byte("tampered binary"),
+		"/binary":   binary,
+	})
+
+	u := testUpdate(key, binary, srv.URL+"/missing", srv.URL+"/tampered", srv.URL+"/binary")
+
+	out, err := c.downloadAgentUpdate(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(binary) {
+		t.Fatalf("unexpected binary %q", out)
+	}
+
+	stored, err := ioutil.ReadFile(c.downloadPath(u.Version))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored) != string(binary) {
+		t.Fatalf("unexpected stored binary %q", stored)
+	}
+
+	// Without a valid binary at any of the URLs, the download fails
+	u = testUpdate(key, binary, srv.URL+"/tampered")
+
+	_, err = c.downloadAgentUpdate(u)
+	if err == nil || !strings.Contains(err.Error(), "SHA-256 digest mismatch") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAgentUpdate_MaxBinarySize(t *testing.T) {
+
+	defer func(size int) { updateMaxBinarySize = size }(updateMaxBinarySize)
+	updateMaxBinarySize = 16
+
+	c, key := testUpdateClient(t)
+
+	binary := []byte(strings.Repeat("x", updateMaxBinarySize+1))
+
+	srv := binaryServer(t, map[string][]byte{"/binary": binary})
+
+	_, err := c.downloadAgentUpdate(testUpdate(key, binary, srv.URL+"/binary"))
+	if err == nil || !strings.Contains(err.Error(), "binary larger than 16 bytes") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAgentUpdate_Rollback(t *testing.T) {
+
+	cases := map[string]*updateMarker{
+		"max starts": {
+			Starts:   updateMaxStarts,
+			Deadline: time.Now().Add(time.Hour),
+		},
+		"deadline passed": {
+			Deadline: time.Now().Add(-time.Minute),
+		},
+	}
+
+	for name, m := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			executed := ""
+			defer func(f func(string) error) { execBinary = f }(execBinary)
+			execBinary = func(path string) error {
+				executed = path
+				return nil
+			}
+
+			c, key := testUpdateClient(t)
+			c.config.Version = &version.VersionInfo{Version: "2.0.0"}
+
+			dir := t.TempDir()
+
+			m.Version = "2.0.0"
+			m.PreviousVersion = "1.0.0"
+			m.BinaryPath = filepath.Join(dir, "seashell")
+			m.BackupPath = filepath.Join(dir, "seashell.old")
+
+			if err := ioutil.WriteFile(m.BinaryPath, []byte("new"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(m.BackupPath, []byte("old"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.writeUpdateMarker(m); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.setupUpdate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if executed != m.BinaryPath {
+				t.Fatalf("previous binary not executed")
+			}
+
+			restored, err := ioutil.ReadFile(m.BinaryPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(restored) != "old" || exists(m.BackupPath) {
+				t.Fatalf("previous binary not restored")
+			}
+
+			marker, err := c.readUpdateMarker()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if marker == nil || !marker.RolledBack || marker.Error == "" {
+				t.Fatalf("unexpected update marker: %+v", marker)
+			}
+
+			// Once the previous version starts, the update is reported
+			// as rolled back, and it is not installed again
+			c.config.Version = &version.VersionInfo{Version: "1.0.0"}
+			c.update = newUpdateState()
+
+			if err := c.setupUpdate(); err != nil {
+				t.Fatal(err)
+			}
+			if c.update.rolledBack != "2.0.0" {
+				t.Fatalf("rolled back version not recorded")
+			}
+			if status := c.AgentUpdateStatus(); status == nil || status.State != structs.AgentUpdateStateRolledBack {
+				t.Fatalf("unexpected update status: %+v", status)
+			}
+
+			c.checkAgentUpdate(testUpdate(key, []byte("new"), "http://127.0.0.1:0/binary"))
+			if c.update.inProgress {
+				t.Fatal("rolled back version installed again")
+			}
+		})
+	}
+}
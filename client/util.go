@@ -1,9 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -32,25 +38,169 @@ func (c *Client) readFileLazy(path string, s string) (string, error) {
 	return out, nil
 }
 
-func renderTemplateToFile(tmplStr string, out string, data interface{}) error {
+// templateFuncs contains the functions available to templates
+var templateFuncs = template.FuncMap{
+	"list":  hclList,
+	"quote": strconv.Quote,
+	"body":  hclBody,
+	"join":  strings.Join,
+}
+
+func renderTemplate(tmplStr string, data interface{}) ([]byte, error) {
 
-	tmpl, err := template.New(strings.Split(uuid.Generate(), "-")[0]).Parse(tmplStr)
+	tmpl, err := template.New(strings.Split(uuid.Generate(), "-")[0]).Funcs(templateFuncs).Parse(tmplStr)
 	if err != nil {
-		return fmt.Errorf("error parsing template : %v", err)
+		return nil, fmt.Errorf("error parsing template : %v", err)
+	}
+
+	buf := &bytes.Buffer{}
 
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering template: %v", err)
 	}
 
-	f, err := os.Create(out)
+	return buf.Bytes(), nil
+}
+
+// writeTempFile writes content to a temporary file located in the same
+// directory as out, so that it can later be atomically renamed to it. The
+// temporary file keeps the extension of out, e.g. .consul.hcl.123.hcl, as
+// validators such as consul validate pick the format of files from it.
+func writeTempFile(out string, content []byte, mode os.FileMode) (string, error) {
+
+	base := filepath.Base(out)
+
+	f, err := ioutil.TempFile(filepath.Dir(out), "."+base+".*"+filepath.Ext(base))
 	if err != nil {
-		return fmt.Errorf("error creating file: %v", err)
+		return "", fmt.Errorf("error creating file: %v", err)
 	}
 
 	defer f.Close()
 
-	err = tmpl.Execute(f, data)
+	if err := f.Chmod(mode); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error setting file mode: %v", err)
+	}
+
+	if _, err := f.Write(content); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("error writing file: %v", err)
+	}
+
+	return f.Name(), nil
+}
+
+// stagedFile is a file written to a temporary path, which replaces the
+// file at path once committed. An empty content stages its removal.
+type stagedFile struct {
+	path    string
+	tmp     string
+	content string
+}
+
+func (f *stagedFile) checksum() string {
+	if f.content == "" {
+		return ""
+	}
+	return checksum([]byte(f.content))
+}
+
+// stageFiles writes files, keyed by path, to temporary files
+// located in the same directories, in a deterministic order
+func stageFiles(files map[string]string, mode os.FileMode) ([]*stagedFile, error) {
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	staged := []*stagedFile{}
+
+	for _, p := range paths {
+
+		f := &stagedFile{path: p, content: files[p]}
+
+		if f.content != "" {
+
+			if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+				discardStagedFiles(staged)
+				return nil, fmt.Errorf("error creating directory: %v", err)
+			}
+
+			tmp, err := writeTempFile(p, []byte(f.content), mode)
+			if err != nil {
+				discardStagedFiles(staged)
+				return nil, err
+			}
+
+			f.tmp = tmp
+		}
+
+		staged = append(staged, f)
+	}
+
+	return staged, nil
+}
+
+// commitStagedFiles moves staged files into place, and removes
+// those whose removal was staged
+func commitStagedFiles(staged []*stagedFile) error {
+
+	for _, f := range staged {
+
+		if f.tmp == "" {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing %s: %v", f.path, err)
+			}
+			continue
+		}
+
+		if err := os.Rename(f.tmp, f.path); err != nil {
+			return fmt.Errorf("error replacing %s: %v", f.path, err)
+		}
+
+		f.tmp = ""
+	}
+
+	return nil
+}
+
+// discardStagedFiles removes the temporary files of staged
+// files which were not committed
+func discardStagedFiles(staged []*stagedFile) {
+	for _, f := range staged {
+		if f.tmp != "" {
+			os.Remove(f.tmp)
+		}
+	}
+}
+
+// writeFileAtomic writes content to a temporary file with the given
+// mode, and then atomically replaces the file at out with it.
+func writeFileAtomic(out string, content []byte, mode os.FileMode) error {
+
+	tmp, err := writeTempFile(out, content, mode)
 	if err != nil {
-		return fmt.Errorf("error rendering template: %v", err)
+		return err
+	}
+
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing file: %v", err)
 	}
 
 	return nil
 }
+
+// checksum returns the hex-encoded SHA-256 checksum of content
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+const (
+	defaultValidatorTimeout = 30 * time.Second
+
+	// validatorFilePlaceholder is replaced by the path to the
+	// rendered file in the arguments of validator commands.
+	validatorFilePlaceholder = "{file}"
+)
+
+// ValidatorConfig contains the configuration of a post-render
+// validator, which is run against a freshly rendered module
+// configuration before it replaces the live one.
+type ValidatorConfig struct {
+
+	// Command is executed with the path to the rendered file, either in
+	// place of the {file} placeholder or appended as the last argument.
+	// A non-zero exit status causes the rendered file to be rejected.
+	Command string
+
+	// ParseHCL causes the rendered file to be parsed in-process as HCL.
+	ParseHCL bool
+
+	// Timeout is the maximum time the validator command is allowed to run.
+	Timeout time.Duration
+}
+
+// validateRenderedFile runs the validator configured for a module, if any,
+// against the file at the given path.
+func (c *Client) validateRenderedFile(module string, path string) error {
+
+	v, ok := c.config.Validators[module]
+	if !ok || v == nil {
+		return nil
+	}
+
+	if v.ParseHCL {
+		if err := validateHCLFile(path); err != nil {
+			return err
+		}
+	}
+
+	if v.Command != "" {
+		timeout := v.Timeout
+		if timeout == 0 {
+			timeout = defaultValidatorTimeout
+		}
+		if err := validateWithCommand(v.Command, path, timeout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateHCLFile(path string) error {
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading rendered file: %v", err)
+	}
+
+	_, diags := hclparse.NewParser().ParseHCL(buf, path)
+	if diags.HasErrors() {
+		return fmt.Errorf("invalid HCL: %v", diags.Error())
+	}
+
+	return nil
+}
+
+func validateWithCommand(command string, path string, timeout time.Duration) error {
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("empty validator command")
+	}
+
+	found := false
+	for i, arg := range args {
+		if strings.Contains(arg, validatorFilePlaceholder) {
+			args[i] = strings.ReplaceAll(arg, validatorFilePlaceholder, path)
+			found = true
+		}
+	}
+	if !found {
+		args = append(args, path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("validator command %q failed: %v: %s", command, err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
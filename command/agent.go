@@ -8,7 +8,6 @@ import (
 
 	"github.com/caarlos0/env"
 	"github.com/dimiro1/banner"
-	"github.com/hashicorp/hcl/v2/hclsimple"
 	"github.com/joho/godotenv"
 	agent "github.com/seashell/agent/agent"
 	cli "github.com/seashell/agent/pkg/cli"
@@ -145,7 +144,7 @@ func (c *AgentCommand) parseConfigFiles(paths ...string) *agent.Config {
 	if len(paths) > 0 {
 		c.UI.Info(fmt.Sprintf("==> Loading configurations from: %v", paths))
 		for _, s := range paths {
-			err := hclsimple.DecodeFile(s, nil, config)
+			err := agent.DecodeConfigFile(s, config)
 			if err != nil {
 				c.UI.Error("Failed to load configuration: " + err.Error())
 				os.Exit(0)
@@ -0,0 +1,123 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	agent "github.com/seashell/agent/agent"
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+)
+
+// AgentPlanCommand :
+type AgentPlanCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *AgentPlanCommand) Name() string {
+	return "agent plan"
+}
+
+// Synopsis :
+func (c *AgentPlanCommand) Synopsis() string {
+	return "Shows pending configuration changes"
+}
+
+// Run :
+func (c *AgentPlanCommand) Run(ctx context.Context, args []string) int {
+
+	config := loadAgentConfig(c.UI, args)
+
+	logger, err := commandLogger()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	clientConfig, err := agent.NewClientConfig(config, logger)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error loading client configuration: %s", err.Error()))
+		return 1
+	}
+
+	plan, err := client.NewPlan(clientConfig)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error computing plan: %s", err.Error()))
+		return 1
+	}
+
+	if !plan.StateKnown {
+		c.UI.Warn("==> Stored state unavailable, comparing against the files on disk only")
+		c.UI.Output("")
+	}
+
+	for _, m := range plan.Modules {
+
+		if !m.HasChanges() {
+			c.UI.Output(fmt.Sprintf("==> %s: no changes", m.Module))
+			continue
+		}
+
+		c.UI.Output(fmt.Sprintf("==> %s: changes pending", m.Module))
+
+		if m.Error != "" {
+			c.UI.Error(fmt.Sprintf("    Invalid configuration: %s", m.Error))
+		}
+
+		if m.Pinned > 0 {
+			c.UI.Info(fmt.Sprintf("    Pinned to version %d", m.Pinned))
+		}
+
+		if m.StateChanged {
+			c.UI.Info("    Stored state differs from the desired configuration")
+		}
+
+		for _, f := range m.Files {
+
+			if !f.HasChanges() {
+				continue
+			}
+
+			switch {
+			case f.Delete:
+				c.UI.Output(fmt.Sprintf("    %s would be deleted", f.Path))
+			case f.Sensitive:
+				c.UI.Output(fmt.Sprintf("    %s would be written (sensitive content not shown)", f.Path))
+			default:
+				c.UI.Output("")
+				c.UI.Output(strings.TrimSuffix(f.Diff(), "\n"))
+			}
+		}
+
+		c.UI.Output("")
+	}
+
+	if !plan.HasChanges() {
+		c.UI.Output("\nNo changes. The device is up-to-date.")
+	}
+
+	return 0
+}
+
+// Help :
+func (c *AgentPlanCommand) Help() string {
+	h := `
+Usage: seashell agent plan [options]
+
+  Fetches the desired configuration from the Seashell Cloud and shows
+  the changes that the agent would apply to each module, as a unified
+  diff against the files currently on disk. Local overrides and pinned
+  versions are applied as during reconciliation. Secrets such as tokens
+  and keys are redacted, and the contents of managed files and TLS
+  material are not shown. Nothing is written to disk.
+
+  The stored client state can only be compared while the agent is
+  stopped, since the running agent holds an exclusive lock on it.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
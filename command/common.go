@@ -4,7 +4,11 @@ import (
 	"flag"
 	"fmt"
 
+	agent "github.com/seashell/agent/agent"
+	client "github.com/seashell/agent/client"
 	cli "github.com/seashell/agent/pkg/cli"
+	log "github.com/seashell/agent/pkg/log"
+	logrus "github.com/seashell/agent/pkg/log/logrus"
 )
 
 // manyStrings
@@ -66,3 +70,38 @@ func GlobalOptions() string {
 func DefaultErrorMessage(cmd cli.NamedCommand) string {
 	return fmt.Sprintf("For additional help try 'seashell %s --help'", cmd.Name())
 }
+
+// loadAgentConfig loads the agent configuration from flags, config
+// files and env files, in the same way as the agent command does.
+func loadAgentConfig(ui cli.UI, args []string) *agent.Config {
+	return (&AgentCommand{UI: ui}).parseConfig(args)
+}
+
+// commandLogger returns a logger for commands other than the agent,
+// which only outputs warnings and errors so as not to clutter their output.
+func commandLogger() (log.Logger, error) {
+	return logrus.NewLoggerAdapter(logrus.Config{
+		LoggerOptions: log.LoggerOptions{
+			Level: "warn",
+		},
+	})
+}
+
+// loadClientConfig loads the agent configuration from flags, config files
+// and env files, and derives the client configuration from it.
+func loadClientConfig(ui cli.UI, args []string) (*agent.Config, *client.Config, error) {
+
+	config := loadAgentConfig(ui, args)
+
+	logger, err := commandLogger()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientConfig, err := agent.NewClientConfig(config, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading client configuration: %s", err.Error())
+	}
+
+	return config, clientConfig, nil
+}
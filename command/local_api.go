@@ -0,0 +1,110 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	agent "github.com/seashell/agent/agent"
+	client "github.com/seashell/agent/client"
+	middleware "github.com/seashell/agent/client/adapter/http/middleware"
+)
+
+const (
+	// localAPITimeout is the timeout of requests to the local API
+	localAPITimeout = 30 * time.Second
+)
+
+// localAPI is a client of the local HTTP API of a running agent, which
+// is used by commands that cannot access the client state directly
+// because the agent holds its lock.
+type localAPI struct {
+	addr       string
+	token      string
+	tokenErr   error
+	httpClient *http.Client
+}
+
+func newLocalAPI(config *agent.Config) *localAPI {
+
+	token, err := agent.LoadAPIToken(config)
+
+	return &localAPI{
+		addr:       "http://" + config.HTTPAddr,
+		token:      token,
+		tokenErr:   err,
+		httpClient: &http.Client{Timeout: localAPITimeout},
+	}
+}
+
+// do sends a request to the local API, encoding in as the request body
+// and decoding the response body into out, in case they are not nil.
+func (a *localAPI) do(method, path string, in, out interface{}) error {
+
+	if a.tokenErr != nil {
+		return a.tokenErr
+	}
+
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, a.addr+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(middleware.TokenHeader, a.token)
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach the agent at %s: %v", a.addr, err)
+	}
+	defer resp.Body.Close()
+
+	encoded, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		e := struct{ Message string }{}
+		if err := json.Unmarshal(encoded, &e); err == nil && e.Message != "" {
+			return fmt.Errorf("%s", e.Message)
+		}
+		return fmt.Errorf("unexpected response from the agent: %s", resp.Status)
+	}
+
+	if out != nil && len(encoded) > 0 {
+		return json.Unmarshal(encoded, out)
+	}
+
+	return nil
+}
+
+// withClientState runs direct on the client state in case it can be
+// accessed directly, or falls back to running viaAPI in case the
+// agent is running, and therefore holds the state lock, or keeps
+// its state in memory.
+func withClientState(config *client.Config, direct func() error, viaAPI func() error) error {
+
+	if config.StateBackend == client.StateBackendInmem {
+		return viaAPI()
+	}
+
+	err := direct()
+	if client.IsStateLocked(err) {
+		return viaAPI()
+	}
+
+	return err
+}
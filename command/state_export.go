@@ -0,0 +1,93 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// StateExportCommand :
+type StateExportCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateExportCommand) Name() string {
+	return "state export"
+}
+
+// Synopsis :
+func (c *StateExportCommand) Synopsis() string {
+	return "Exports the client state as JSON"
+}
+
+// Run :
+func (c *StateExportCommand) Run(ctx context.Context, args []string) int {
+
+	// Informational messages are written to the error output,
+	// so that they do not end up in the exported document
+	config, clientConfig, err := loadClientConfig(&infoToErrorUI{c.UI}, args)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var e *structs.StateExport
+
+	err = withClientState(clientConfig,
+		func() (err error) {
+			e, err = client.ExportState(clientConfig)
+			return err
+		},
+		func() error {
+			e = &structs.StateExport{}
+			return newLocalAPI(config).do("GET", "/v1/state/export", nil, e)
+		})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error exporting client state: %s", err.Error()))
+		return 1
+	}
+
+	encoded, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	c.UI.Output(string(encoded))
+
+	return 0
+}
+
+// Help :
+func (c *StateExportCommand) Help() string {
+	h := `
+Usage: seashell state export [options]
+
+  Writes the client state to the standard output as a versioned JSON
+  document, which can be imported with "seashell state import". The
+  document contains the configurations last applied to each module,
+  their history and the configuration override, including secrets.
+
+  The client state is read directly while the agent is stopped, or through
+  the local API of the agent while it is running.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
+
+// infoToErrorUI is a UI which writes informational messages to the error output
+type infoToErrorUI struct {
+	cli.UI
+}
+
+func (u *infoToErrorUI) Info(message string) {
+	u.UI.Error(message)
+}
@@ -0,0 +1,110 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	agent "github.com/seashell/agent/agent"
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// StateHistoryCommand :
+type StateHistoryCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateHistoryCommand) Name() string {
+	return "state history"
+}
+
+// Synopsis :
+func (c *StateHistoryCommand) Synopsis() string {
+	return "Lists applied configuration versions"
+}
+
+// Run :
+func (c *StateHistoryCommand) Run(ctx context.Context, args []string) int {
+
+	modules := append([]string{structs.ConfigurationVersionRemote}, client.ModuleNames()...)
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		modules = []string{args[0]}
+		args = args[1:]
+	}
+
+	config := loadAgentConfig(c.UI, args)
+
+	logger, err := commandLogger()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	clientConfig, err := agent.NewClientConfig(config, logger)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error loading client configuration: %s", err.Error()))
+		return 1
+	}
+
+	versions, err := client.ConfigurationHistory(clientConfig, modules...)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading configuration history: %s", err.Error()))
+		return 1
+	}
+
+	if len(versions) == 0 {
+		c.UI.Output("No configuration versions found")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tVERSION\tTIMESTAMP\tMETA")
+	for _, v := range versions {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", v.Module, v.Version, v.Timestamp.Format("2006-01-02 15:04:05 MST"), formatMeta(v.Meta))
+	}
+	w.Flush()
+
+	return 0
+}
+
+func formatMeta(meta map[string]string) string {
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, fmt.Sprintf("%s=%q", k, meta[k]))
+	}
+
+	return strings.Join(out, " ")
+}
+
+// Help :
+func (c *StateHistoryCommand) Help() string {
+	h := `
+Usage: seashell state history [module] [options]
+
+  Lists the configuration versions applied by the agent, for a single
+  module or for all of them. Raw configurations received from the Seashell
+  Cloud are listed under the "remote" module, along with the metadata of
+  the API response they were received in.
+
+  This command reads the client state directly, and therefore can only
+  be used while the agent is stopped.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
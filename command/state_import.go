@@ -0,0 +1,101 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+	structs "github.com/seashell/agent/seashell/structs"
+)
+
+// StateImportCommand :
+type StateImportCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateImportCommand) Name() string {
+	return "state import"
+}
+
+// Synopsis :
+func (c *StateImportCommand) Synopsis() string {
+	return "Imports a client state exported as JSON"
+}
+
+// Run :
+func (c *StateImportCommand) Run(ctx context.Context, args []string) int {
+
+	if len(args) < 1 {
+		c.UI.Error("This command takes one argument: <file>")
+		c.UI.Error(DefaultErrorMessage(c))
+		return 1
+	}
+
+	var encoded []byte
+	var err error
+
+	if args[0] == "-" {
+		encoded, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		encoded, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading %s: %s", args[0], err.Error()))
+		return 1
+	}
+
+	e := &structs.StateExport{}
+	if err := json.Unmarshal(encoded, e); err != nil {
+		c.UI.Error(fmt.Sprintf("Error decoding %s: %s", args[0], err.Error()))
+		return 1
+	}
+
+	config, clientConfig, err := loadClientConfig(c.UI, args[1:])
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	err = withClientState(clientConfig,
+		func() error {
+			return client.ImportState(clientConfig, e)
+		},
+		func() error {
+			return newLocalAPI(config).do("PUT", "/v1/state/import", e, nil)
+		})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error importing client state: %s", err.Error()))
+		return 1
+	}
+
+	c.UI.Output("==> Imported client state")
+	c.UI.Output("    Modules whose configuration changed will be rendered again on the next reconciliation.")
+
+	return 0
+}
+
+// Help :
+func (c *StateImportCommand) Help() string {
+	h := `
+Usage: seashell state import <file> [options]
+
+  Imports a document written by "seashell state export", read from the
+  given file, or from the standard input if it is "-". The configurations
+  and the configuration override in the client state are replaced with
+  those of the document, whose history is appended to the one in the
+  client state. Module pins are released.
+
+  The client state is modified directly while the agent is stopped, or
+  through the local API of the agent while it is running.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
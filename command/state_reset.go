@@ -0,0 +1,82 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+)
+
+// StateResetCommand :
+type StateResetCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateResetCommand) Name() string {
+	return "state reset"
+}
+
+// Synopsis :
+func (c *StateResetCommand) Synopsis() string {
+	return "Forces modules to be rendered again"
+}
+
+// Run :
+func (c *StateResetCommand) Run(ctx context.Context, args []string) int {
+
+	module := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		module = args[0]
+		args = args[1:]
+	}
+
+	config, clientConfig, err := loadClientConfig(c.UI, args)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	err = withClientState(clientConfig,
+		func() error {
+			return client.ResetState(clientConfig, module)
+		},
+		func() error {
+			return newLocalAPI(config).do("POST", "/v1/state/reset?module="+url.QueryEscape(module), nil, nil)
+		})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error resetting client state: %s", err.Error()))
+		return 1
+	}
+
+	if module == "" {
+		module = "all modules"
+	}
+
+	c.UI.Output(fmt.Sprintf("==> Reset the stored configuration of %s", module))
+	c.UI.Output("    It will be rendered again on the next reconciliation.")
+
+	return 0
+}
+
+// Help :
+func (c *StateResetCommand) Help() string {
+	h := `
+Usage: seashell state reset [module] [options]
+
+  Deletes the configuration stored in the client state for a single module,
+  or for all of them, so that it is rendered again on the next reconciliation
+  even if the desired configuration did not change. The configuration history
+  is kept.
+
+  The client state is modified directly while the agent is stopped, or
+  through the local API of the agent while it is running.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	agent "github.com/seashell/agent/agent"
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+)
+
+// StateRollbackCommand :
+type StateRollbackCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateRollbackCommand) Name() string {
+	return "state rollback"
+}
+
+// Synopsis :
+func (c *StateRollbackCommand) Synopsis() string {
+	return "Rolls a module back to a previous configuration"
+}
+
+// Run :
+func (c *StateRollbackCommand) Run(ctx context.Context, args []string) int {
+
+	if len(args) < 2 {
+		c.UI.Error("This command takes two arguments: <module> <version>")
+		c.UI.Error(DefaultErrorMessage(c))
+		return 1
+	}
+
+	module := args[0]
+
+	version, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Invalid version %q", args[1]))
+		return 1
+	}
+
+	config := loadAgentConfig(c.UI, args[2:])
+
+	logger, err := commandLogger()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	clientConfig, err := agent.NewClientConfig(config, logger)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error loading client configuration: %s", err.Error()))
+		return 1
+	}
+
+	if err := client.Rollback(clientConfig, module, version); err != nil {
+		c.UI.Error(fmt.Sprintf("Error rolling back: %s", err.Error()))
+		return 1
+	}
+
+	c.UI.Output(fmt.Sprintf("==> Rolled %s back to version %d", module, version))
+	c.UI.Output("    The module will stay pinned to this version until the remote configuration changes.")
+
+	return 0
+}
+
+// Help :
+func (c *StateRollbackCommand) Help() string {
+	h := `
+Usage: seashell state rollback <module> <version> [options]
+
+  Re-renders a previously applied configuration version of a module, as
+  listed by "seashell state history", and pins the module to it. The pin
+  is released as soon as a different configuration is received from the
+  Seashell Cloud.
+
+  This command operates on the client state directly, and therefore can
+  only be used while the agent is stopped.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
@@ -0,0 +1,97 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	client "github.com/seashell/agent/client"
+	cli "github.com/seashell/agent/pkg/cli"
+)
+
+// StateShowCommand :
+type StateShowCommand struct {
+	UI cli.UI
+}
+
+// Name :
+func (c *StateShowCommand) Name() string {
+	return "state show"
+}
+
+// Synopsis :
+func (c *StateShowCommand) Synopsis() string {
+	return "Shows the configurations stored in the client state"
+}
+
+// Run :
+func (c *StateShowCommand) Run(ctx context.Context, args []string) int {
+
+	module := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		module = args[0]
+		args = args[1:]
+	}
+
+	config, clientConfig, err := loadClientConfig(c.UI, args)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	var configs map[string]interface{}
+
+	err = withClientState(clientConfig,
+		func() (err error) {
+			configs, err = client.StoredConfigurations(clientConfig, module)
+			return err
+		},
+		func() error {
+			return newLocalAPI(config).do("GET", "/v1/state?module="+url.QueryEscape(module), nil, &configs)
+		})
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error reading client state: %s", err.Error()))
+		return 1
+	}
+
+	if len(configs) == 0 {
+		c.UI.Output("No configurations stored")
+		return 0
+	}
+
+	for _, m := range client.ModuleNames() {
+		config, ok := configs[m]
+		if !ok {
+			continue
+		}
+		encoded, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			c.UI.Error(err.Error())
+			return 1
+		}
+		c.UI.Output(fmt.Sprintf("==> %s", m))
+		c.UI.Output(string(encoded))
+	}
+
+	return 0
+}
+
+// Help :
+func (c *StateShowCommand) Help() string {
+	h := `
+Usage: seashell state show [module] [options]
+
+  Shows the configurations stored in the client state, i.e. the ones last
+  applied by the agent, for a single module or for all of them. Secrets
+  are redacted.
+
+  The client state is read directly while the agent is stopped, or through
+  the local API of the agent while it is running.
+
+General Options:
+` + GlobalOptions() + `
+`
+	return strings.TrimSpace(h)
+}
@@ -6,6 +6,17 @@ data_dir  = "/tmp/seashell"
 
 api_addr = "http://localhost:8123"
 
+# Configuration changes received from the Seashell Cloud are held until one
+# of the maintenance windows opens, unless they are flagged as urgent. The
+# schedule is a cron expression, evaluated in the timezone of the window
+# (the system's by default). Pending changes can be applied right away with
+# POST /v1/maintenance/apply.
+# maintenance_window {
+#     schedule = "0 2 * * *"
+#     duration = "2h"
+#     timezone = "Europe/Berlin"
+# }
+
 client {
     organization_id = "f56c6f14-4136-4845-a2be-6bd72f599422"
     project_id = "a36401f0-b322-42b9-9a6b-64de4d998cfd"
@@ -13,4 +24,88 @@ client {
     device_id = "0af3d1e8-2b39-4f50-9622-526003b51ffb"
     device_secret = "nq3DhWYsM3jMXHGIS8S5"
     device_remote_id = "device-xyz"
+
+    # Values of the meta, as well as the labels received from the Seashell
+    # Cloud, can reference device facts and, for labels, the meta, e.g.
+    # "${fact.hostname}", "${fact.modem.imei}" or "${meta.rack}". Labels
+    # with undefined references cause the reconciliation to fail.
+    # meta = {
+    #     rack = "${fact.hostname}"
+    # }
+
+    # Rendered configurations can be validated before replacing the live ones.
+    # validator "nomad" {
+    #     command = "nomad config validate {file}"
+    #     timeout = "10s"
+    # }
+    #
+    # validator "consul" {
+    #     hcl = true
+    # }
+
+    # The client state can be kept in memory ("inmem") rather than in a BoltDB
+    # file ("boltdb", the default), e.g. on read-only root filesystems. It is
+    # then lost whenever the agent restarts.
+    # state_backend = "inmem"
+
+    # A corrupted client state is moved aside and replaced with its latest
+    # backup ("restore", the default), with a fresh state ("reset"), or
+    # causes the agent to fail to start ("none").
+    # state_recovery = "restore"
+
+    # Rendered files modified or deleted by hand are repaired, unless drift is only to be reported.
+    # drift_report_only = true
+
+    # Hooks are run through the shell when the rendered output of a module
+    # changes ("on_change"), when the agent starts ("on_start"), or at an
+    # interval ("periodic"). Device identifiers, meta and labels are injected
+    # as SEASHELL_* environment variables.
+    # hook "reload-nomad" {
+    #     trigger = "on_change"
+    #     module  = "nomad"
+    #     command = "systemctl reload nomad"
+    #     timeout = "30s"
+    # }
+    #
+    # Hooks received from the Seashell Cloud are ignored unless explicitly allowed.
+    # allow_remote_hooks = false
+
+    # Files pushed through the files module can only be written under these directories.
+    # file_roots = ["/etc/seashell.d/files", "/usr/local/share/ca-certificates"]
+
+    # The Docker daemon configuration is rendered from the runtime settings
+    # sent by the Seashell Cloud, if any, and the runtime is restarted
+    # whenever it changes. Without them, the file is left untouched.
+    # container_runtime {
+    #     daemon_config_path = "/etc/docker/daemon.json"
+    #     socket_path        = "/var/run/docker.sock"
+    #     restart_command    = "systemctl restart docker"
+    # }
+
+    # Executables in the facts directory (<data_dir>/facts.d by default) are
+    # run to collect custom facts, e.g. a modem IMEI, which are reported to
+    # the Seashell Cloud along with the device facts and meta. They must print
+    # either a JSON object or key=value lines, and their output is reused
+    # until it is older than the ttl.
+    # facts {
+    #     dir     = "/etc/seashell/facts.d"
+    #     ttl     = "5m"
+    #     timeout = "10s"
+    # }
+
+    # The agent updates itself to the version advertised by the Seashell Cloud,
+    # provided that its binary is signed with the ed25519 key whose public
+    # part is pinned here. The previous binary is restored in case the new
+    # version does not complete a reconciliation within the ready_timeout.
+    # self_update {
+    #     public_key    = "<base64-encoded ed25519 public key>"
+    #     binary_path   = "/usr/local/bin/seashell"
+    #     ready_timeout = "2m"
+    # }
+
+    # drago {
+    #     wireguard_path   = "/usr/local/bin/wireguard"
+    #     interface_prefix = "dg-"
+    #     listen_port      = 51820
+    # }
 }
\ No newline at end of file
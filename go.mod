@@ -14,11 +14,13 @@ require (
 	github.com/hashicorp/hcl/v2 v2.8.2
 	github.com/imdario/mergo v0.3.11
 	github.com/joho/godotenv v1.3.0
-	github.com/mitchellh/hashstructure/v2 v2.0.1 // indirect
+	github.com/mitchellh/hashstructure/v2 v2.0.1
 	github.com/pkg/errors v0.9.1
 	github.com/shurcooL/go v0.0.0-20200502201357-93f07166e636 // indirect
 	github.com/shurcooL/go-goon v0.0.0-20210110234559-7585751d9a17
 	github.com/sirupsen/logrus v1.6.0
+	github.com/vmihailenco/msgpack v3.3.3+incompatible
+	github.com/zclconf/go-cty v1.2.0
 	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.16.0
 )
@@ -83,7 +83,14 @@ func setupCLI() *cli.CLI {
 	cli := cli.New(&cli.Config{
 		Name: "seashell",
 		Commands: map[string]cli.Command{
-			"agent": &command.AgentCommand{UI: ui},
+			"agent":          &command.AgentCommand{UI: ui},
+			"agent plan":     &command.AgentPlanCommand{UI: ui},
+			"state history":  &command.StateHistoryCommand{UI: ui},
+			"state rollback": &command.StateRollbackCommand{UI: ui},
+			"state show":     &command.StateShowCommand{UI: ui},
+			"state export":   &command.StateExportCommand{UI: ui},
+			"state import":   &command.StateImportCommand{UI: ui},
+			"state reset":    &command.StateResetCommand{UI: ui},
 		},
 		Version: version.GetVersion().VersionNumber(),
 	})
@@ -0,0 +1,184 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch is how far ahead Next looks for a matching time
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field is the set of values matched by a field of an expression,
+// and whether it was restricted, i.e. not a wildcard
+type field struct {
+	values     map[int]bool
+	restricted bool
+}
+
+func (f field) matches(v int) bool {
+	return f.values[v]
+}
+
+// Schedule is a parsed cron expression, with a resolution of one minute
+type Schedule struct {
+	minute field
+	hour   field
+	dom    field
+	month  field
+	dow    field
+}
+
+// Parse parses a standard cron expression made of five fields, i.e.
+// minute, hour, day of month, month and day of week, or one of the
+// @yearly, @monthly, @weekly, @daily and @hourly macros. Fields can be
+// wildcards, values, ranges and lists, with optional steps, e.g.
+// "*/15 2-4 * * 1,3,5". Sunday is either 0 or 7.
+func Parse(expr string) (*Schedule, error) {
+
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[expr]; ok {
+		expr = m
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{}
+
+	var err error
+
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %v", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %v", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %v", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month field: %v", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %v", err)
+	}
+
+	if s.dow.values[7] {
+		s.dow.values[0] = true
+	}
+
+	return s, nil
+}
+
+func parseField(s string, min, max int) (field, error) {
+
+	// As in cron, fields starting with a wildcard, e.g. "*/2", are unrestricted
+	f := field{values: map[int]bool{}, restricted: !strings.HasPrefix(s, "*")}
+
+	for _, part := range strings.Split(s, ",") {
+
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return f, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return f, fmt.Errorf("invalid range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return f, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return f, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = v, v
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return f, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			f.values[v] = true
+		}
+	}
+
+	return f, nil
+}
+
+// Matches returns true if the minute of t matches the schedule, in the
+// location of t. As in cron, if both the day of month and the day of week
+// are restricted, a day matches if either of them does.
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute.matches(t.Minute()) && s.hour.matches(t.Hour()) && s.matchesDay(t)
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+
+	if !s.month.matches(int(t.Month())) {
+		return false
+	}
+
+	dom, dow := s.dom.matches(t.Day()), s.dow.matches(int(t.Weekday()))
+
+	if s.dom.restricted && s.dow.restricted {
+		return dom || dow
+	}
+
+	return dom && dow
+}
+
+// Next returns the first minute after t which matches the schedule,
+// in the location of t, or the zero time if there is none within
+// the next five years, e.g. for "0 0 30 2 *".
+func (s *Schedule) Next(t time.Time) time.Time {
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(maxSearch)
+
+	for t.Before(end) {
+		switch {
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour.matches(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute.matches(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,273 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	ChangeTypeAdded    = "added"
+	ChangeTypeRemoved  = "removed"
+	ChangeTypeModified = "modified"
+)
+
+const (
+	// tagName is the struct tag used to control how fields are diffed.
+	// Fields tagged with `diff:"sensitive"` have their values redacted,
+	// whereas fields tagged with `diff:"-"` are ignored.
+	tagName = "diff"
+
+	redacted = "(sensitive)"
+)
+
+// Change describes a change to a single field of an object
+type Change struct {
+	Type      string
+	Path      string
+	Old       string `json:",omitempty"`
+	New       string `json:",omitempty"`
+	Sensitive bool   `json:",omitempty"`
+}
+
+// String returns a human-readable description of the change
+func (c Change) String() string {
+	switch c.Type {
+	case ChangeTypeAdded:
+		return fmt.Sprintf("%s: added %s", c.Path, c.New)
+	case ChangeTypeRemoved:
+		return fmt.Sprintf("%s: removed %s", c.Path, c.Old)
+	default:
+		if c.Sensitive {
+			return fmt.Sprintf("%s: changed", c.Path)
+		}
+		return fmt.Sprintf("%s: %s => %s", c.Path, c.Old, c.New)
+	}
+}
+
+// Objects returns the field-level changes between objects a and b, which
+// must be of the same type. Nil pointers are compared as zero values.
+func Objects(a, b interface{}) []Change {
+	changes := []Change{}
+	walk(&changes, "", reflect.ValueOf(a), reflect.ValueOf(b), false)
+	return changes
+}
+
+func walk(changes *[]Change, path string, a, b reflect.Value, sensitive bool) {
+
+	// Values missing from either side, e.g. elements added to a list,
+	// are reported as added or removed rather than modified
+	added, removed := !a.IsValid(), !b.IsValid()
+
+	a, b = indirect(a, b)
+
+	if !a.IsValid() && !b.IsValid() {
+		return
+	}
+
+	// Values of different types, e.g. within maps of interfaces,
+	// can only be compared as a whole
+	if a.Type() != b.Type() {
+		*changes = append(*changes, change(ChangeTypeModified, path, format(a), format(b), sensitive))
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			tag := f.Tag.Get(tagName)
+			if tag == "-" {
+				continue
+			}
+			// Fields of embedded structs are diffed as if they were
+			// fields of the embedding struct
+			p := join(path, f.Name)
+			if f.Anonymous {
+				p = path
+			}
+			fa, fb := a.Field(i), b.Field(i)
+			if added {
+				fa = reflect.Value{}
+			}
+			if removed {
+				fb = reflect.Value{}
+			}
+			walk(changes, p, fa, fb, sensitive || tag == "sensitive")
+		}
+
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, k := range a.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, k := range b.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for _, name := range sortedKeys(keys) {
+			k := keys[name]
+			va, vb := a.MapIndex(k), b.MapIndex(k)
+			p := join(path, name)
+			switch {
+			case !va.IsValid() && isScalar(a.Type().Elem()):
+				*changes = append(*changes, change(ChangeTypeAdded, p, "", format(vb), sensitive))
+			case !vb.IsValid() && isScalar(a.Type().Elem()):
+				*changes = append(*changes, change(ChangeTypeRemoved, p, format(va), "", sensitive))
+			default:
+				// Composite values are walked against their zero value,
+				// so that their sensitive fields are redacted
+				walk(changes, p, va, vb, sensitive)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if isScalar(a.Type().Elem()) {
+			// Lists of scalars are compared as sets, e.g. lists of servers
+			as, bs := elements(a), elements(b)
+			for _, v := range sortedKeys(bs) {
+				if _, ok := as[v]; !ok {
+					*changes = append(*changes, change(ChangeTypeAdded, path, "", v, sensitive))
+				}
+			}
+			for _, v := range sortedKeys(as) {
+				if _, ok := bs[v]; !ok {
+					*changes = append(*changes, change(ChangeTypeRemoved, path, v, "", sensitive))
+				}
+			}
+			return
+		}
+		n := a.Len()
+		if b.Len() > n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= a.Len():
+				walk(changes, p, reflect.Value{}, b.Index(i), sensitive)
+			case i >= b.Len():
+				walk(changes, p, a.Index(i), reflect.Value{}, sensitive)
+			default:
+				walk(changes, p, a.Index(i), b.Index(i), sensitive)
+			}
+		}
+
+	default:
+		switch {
+		case added:
+			if !b.IsZero() {
+				*changes = append(*changes, change(ChangeTypeAdded, path, "", format(b), sensitive))
+			}
+		case removed:
+			if !a.IsZero() {
+				*changes = append(*changes, change(ChangeTypeRemoved, path, format(a), "", sensitive))
+			}
+		case !reflect.DeepEqual(a.Interface(), b.Interface()):
+			*changes = append(*changes, change(ChangeTypeModified, path, format(a), format(b), sensitive))
+		}
+	}
+}
+
+// indirect dereferences pointers and interfaces, replacing nil
+// values with the zero value of the type of their counterpart.
+func indirect(a, b reflect.Value) (reflect.Value, reflect.Value) {
+	for {
+		if a.IsValid() && (a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface) {
+			if a.IsNil() {
+				if b.IsValid() && b.Kind() == a.Kind() && !b.IsNil() {
+					a = reflect.Zero(b.Elem().Type())
+				} else {
+					a = reflect.Value{}
+				}
+			} else {
+				a = a.Elem()
+			}
+			continue
+		}
+		if b.IsValid() && (b.Kind() == reflect.Ptr || b.Kind() == reflect.Interface) {
+			if b.IsNil() {
+				if a.IsValid() {
+					b = reflect.Zero(a.Type())
+				} else {
+					b = reflect.Value{}
+				}
+			} else {
+				b = b.Elem()
+			}
+			continue
+		}
+		break
+	}
+
+	if a.IsValid() && !b.IsValid() {
+		b = reflect.Zero(a.Type())
+	}
+	if b.IsValid() && !a.IsValid() {
+		a = reflect.Zero(b.Type())
+	}
+
+	return a, b
+}
+
+func change(typ, path, old, new string, sensitive bool) Change {
+	c := Change{Type: typ, Path: path, Old: old, New: new, Sensitive: sensitive}
+	if sensitive {
+		if c.Old != "" {
+			c.Old = redacted
+		}
+		if c.New != "" {
+			c.New = redacted
+		}
+	}
+	return c
+}
+
+func format(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func elements(v reflect.Value) map[string]reflect.Value {
+	out := map[string]reflect.Value{}
+	for i := 0; i < v.Len(); i++ {
+		out[format(v.Index(i))] = v.Index(i)
+	}
+	return out
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	if strings.HasPrefix(name, "[") {
+		return path + name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(m map[string]reflect.Value) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
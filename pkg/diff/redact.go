@@ -0,0 +1,129 @@
+package diff
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Redact replaces the values of the fields of in tagged with
+// `diff:"sensitive"` in place, so that it can be displayed. Non-empty
+// strings are replaced with a placeholder, and other values are zeroed.
+// In must be a pointer, and is returned for convenience.
+func Redact(in interface{}) interface{} {
+	redact(reflect.ValueOf(in))
+	return in
+}
+
+func redact(v reflect.Value) {
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			redact(v.Elem())
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Tag.Get(tagName) == "sensitive" {
+				redactValue(v.Field(i))
+				continue
+			}
+			redact(v.Field(i))
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redact(v.Index(i))
+		}
+
+	case reflect.Map:
+		// Map values are not addressable, so only those
+		// referenced through pointers can be redacted
+		for _, k := range v.MapKeys() {
+			redact(v.MapIndex(k))
+		}
+	}
+}
+
+func redactValue(v reflect.Value) {
+
+	if !v.CanSet() || v.IsZero() {
+		return
+	}
+
+	if v.Kind() == reflect.String {
+		v.SetString(redacted)
+		return
+	}
+
+	v.Set(reflect.Zero(v.Type()))
+}
+
+// SensitiveValues returns the non-empty string values of the fields of in
+// tagged with `diff:"sensitive"`, e.g. so that they can be redacted from
+// files rendered from in.
+func SensitiveValues(in interface{}) []string {
+	out := []string{}
+	sensitiveValues(reflect.ValueOf(in), false, &out)
+	return out
+}
+
+func sensitiveValues(v reflect.Value, sensitive bool, out *[]string) {
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			sensitiveValues(v.Elem(), sensitive, out)
+		}
+
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			sensitiveValues(v.Field(i), sensitive || f.Tag.Get(tagName) == "sensitive", out)
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			sensitiveValues(v.Index(i), sensitive, out)
+		}
+
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			sensitiveValues(v.MapIndex(k), sensitive, out)
+		}
+
+	case reflect.String:
+		if sensitive && v.String() != "" {
+			*out = append(*out, v.String())
+		}
+	}
+}
+
+// RedactValues replaces all occurrences of the given values in s with a
+// placeholder. Longer values are replaced first, so that values which
+// contain others are fully redacted.
+func RedactValues(s string, values []string) string {
+
+	sorted := append([]string{}, values...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+
+	for _, v := range sorted {
+		if v != "" {
+			s = strings.ReplaceAll(s, v, redacted)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,199 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultContextLines = 3
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff between strings a and b, labeled with the
+// names passed as argument. An empty string is returned if a and b are equal.
+func Unified(a, b, fromName, toName string) string {
+
+	if a == b {
+		return ""
+	}
+
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "--- %s\n", fromName)
+	fmt.Fprintf(sb, "+++ %s\n", toName)
+
+	for _, h := range hunks(ops, defaultContextLines) {
+		sb.WriteString(h)
+	}
+
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineOps computes the sequence of operations transforming a into b,
+// based on the longest common subsequence of their lines.
+func lineOps(a, b []string) []op {
+
+	n, m := len(a), len(b)
+
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []op{}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{opEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{opDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, op{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{opDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{opInsert, b[j]})
+	}
+
+	return ops
+}
+
+// hunks groups operations into unified diff hunks, keeping
+// up to ctx lines of unchanged context around each change.
+func hunks(ops []op, ctx int) []string {
+
+	out := []string{}
+
+	// Line numbers (0-based) in a and b at the start of each op
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for k, o := range ops {
+		aLine[k+1], bLine[k+1] = aLine[k], bLine[k]
+		if o.kind != opInsert {
+			aLine[k+1]++
+		}
+		if o.kind != opDelete {
+			bLine[k+1]++
+		}
+	}
+
+	k := 0
+	for k < len(ops) {
+
+		// Find the next change
+		for k < len(ops) && ops[k].kind == opEqual {
+			k++
+		}
+		if k == len(ops) {
+			break
+		}
+
+		start := k - ctx
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are close enough to each other
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*ctx {
+				break
+			}
+			end = next
+		}
+
+		stop := end + ctx
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		sb := &strings.Builder{}
+		fmt.Fprintf(sb, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[stop]-aLine[start]),
+			hunkRange(bLine[start], bLine[stop]-bLine[start]))
+
+		for _, o := range ops[start:stop] {
+			prefix := " "
+			switch o.kind {
+			case opDelete:
+				prefix = "-"
+			case opInsert:
+				prefix = "+"
+			}
+			sb.WriteString(prefix + o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		out = append(out, sb.String())
+
+		k = stop
+	}
+
+	return out
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -23,6 +24,7 @@ type Server struct {
 	listener   net.Listener
 	listenerCh chan struct{}
 	mux        *http.ServeMux
+	server     *http.Server
 }
 
 // NewServer :
@@ -57,21 +59,38 @@ func NewServer(config *Config) (*Server, error) {
 		server.mux.HandleFunc(pattern, fcn)
 	}
 
-	httpServer := http.Server{
+	server.server = &http.Server{
 		Addr:    server.listener.Addr().String(),
 		Handler: server.mux,
 	}
 
 	go func() {
 		defer close(server.listenerCh)
-		httpServer.Serve(server.listener)
+		server.server.Serve(server.listener)
 	}()
 
-	server.logger.Debugf("http server started at %s", httpServer.Addr)
+	server.logger.Debugf("http server started at %s", server.server.Addr)
 
 	return server, nil
 }
 
+// Shutdown stops accepting connections and waits for the requests being
+// served to complete, or for ctx to be done, in which case the remaining
+// connections are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.server.Close()
+	}
+
+	<-s.listenerCh
+
+	s.logger.Debugf("http server stopped")
+
+	return err
+}
+
 // httpHandlerFunc converts a custom handler func to http.HandlerFunc
 func httpHandlerFunc(handler Handler) http.HandlerFunc {
 
@@ -0,0 +1,41 @@
+package structs
+
+import (
+	"encoding/json"
+	"time"
+
+	diff "github.com/seashell/agent/pkg/diff"
+)
+
+// ConfigurationChange records the field-level changes applied to the
+// configuration of a module during a reconciliation.
+type ConfigurationChange struct {
+	Module    string
+	Changes   []diff.Change
+	Timestamp time.Time
+}
+
+const (
+	// ConfigurationVersionRemote is the module name under which the raw
+	// configurations received from the API are kept in the history.
+	ConfigurationVersionRemote = "remote"
+)
+
+// ConfigurationVersion is a configuration applied at some point in time,
+// which is kept in the client state so that it can be rolled back to.
+type ConfigurationVersion struct {
+	Version       uint64
+	Module        string
+	Configuration json.RawMessage
+	Meta          map[string]string
+	Timestamp     time.Time
+}
+
+// ConfigurationPin pins a module to a previously applied configuration
+// version for as long as the remote configuration does not change.
+type ConfigurationPin struct {
+	Module     string
+	Version    uint64
+	RemoteHash uint64
+	Timestamp  time.Time
+}
@@ -1,14 +1,21 @@
 package structs
 
-import "github.com/mitchellh/hashstructure/v2"
+import (
+	"encoding/json"
+
+	"github.com/mitchellh/hashstructure/v2"
+)
 
 // DragoConfiguration :
 type DragoConfiguration struct {
-	Name    string
-	DataDir string
-	Servers []string
-	Secret  string
-	Meta    map[string]string
+	Name            string
+	DataDir         string
+	Servers         []string
+	Secret          string `diff:"sensitive"`
+	WireguardPath   string
+	InterfacePrefix string
+	ListenPort      int
+	Meta            map[string]string
 }
 
 // Hash returns a unique hash of the struct
@@ -20,12 +27,49 @@ func (c *DragoConfiguration) Hash() uint64 {
 	return hash
 }
 
+// JoinAddresses contains the addresses of the servers to join. Configurations
+// stored by earlier versions of the agent contain a single address, which
+// may be empty, and are decoded as a list.
+type JoinAddresses []string
+
+// UnmarshalJSON :
+func (a *JoinAddresses) UnmarshalJSON(data []byte) error {
+
+	if string(data) == "null" {
+		return nil
+	}
+
+	var addr string
+	if err := json.Unmarshal(data, &addr); err == nil {
+		*a = JoinAddresses{}
+		if addr != "" {
+			*a = JoinAddresses{addr}
+		}
+		return nil
+	}
+
+	var addrs []string
+	if err := json.Unmarshal(data, &addrs); err != nil {
+		return err
+	}
+
+	*a = addrs
+
+	return nil
+}
+
 // NomadConfiguration :
 type NomadConfiguration struct {
 	Name      string
 	DataDir   string
-	RetryJoin string
+	RetryJoin JoinAddresses
 	Meta      map[string]string
+
+	// DragoInterfacePrefix is the prefix of the names of the
+	// Drago interfaces, to which the agent is bound.
+	DragoInterfacePrefix string
+
+	NomadSettings
 }
 
 // Hash returns a unique hash of the struct
@@ -41,8 +85,20 @@ func (c *NomadConfiguration) Hash() uint64 {
 type ConsulConfiguration struct {
 	Name      string
 	DataDir   string
-	RetryJoin string
+	RetryJoin JoinAddresses
 	Meta      map[string]string
+
+	// DragoInterfacePrefix is the prefix of the names of the
+	// Drago interfaces, to which the agent is bound.
+	DragoInterfacePrefix string
+
+	// CAFile, CertFile and KeyFile are the files to which
+	// the TLS certificate material is written, if any.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+
+	ConsulSettings
 }
 
 // Hash returns a unique hash of the struct
@@ -53,3 +109,31 @@ func (c *ConsulConfiguration) Hash() uint64 {
 	}
 	return hash
 }
+
+// FilesConfiguration :
+type FilesConfiguration struct {
+	Files []*ManagedFile
+}
+
+// Hash returns a unique hash of the struct
+func (c *FilesConfiguration) Hash() uint64 {
+	hash, err := hashstructure.Hash(c, hashstructure.FormatV2, nil)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
+
+// ContainerRuntimeConfiguration :
+type ContainerRuntimeConfiguration struct {
+	ContainerRuntimeSettings
+}
+
+// Hash returns a unique hash of the struct
+func (c *ContainerRuntimeConfiguration) Hash() uint64 {
+	hash, err := hashstructure.Hash(c, hashstructure.FormatV2, nil)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
@@ -0,0 +1,54 @@
+package structs
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJoinAddresses_UnmarshalJSON(t *testing.T) {
+
+	cases := map[string]JoinAddresses{
+		`""`:                       {},
+		`"10.1.0.1:4647"`:          {"10.1.0.1:4647"},
+		`[]`:                       {},
+		`["10.1.0.1", "10.1.0.2"]`: {"10.1.0.1", "10.1.0.2"},
+		`null`:                     nil,
+	}
+
+	for in, expected := range cases {
+		var out JoinAddresses
+		if err := json.Unmarshal([]byte(in), &out); err != nil {
+			t.Fatalf("%s: %v", in, err)
+		}
+		if !reflect.DeepEqual(out, expected) {
+			t.Errorf("%s: decoded %#v, expected %#v", in, out, expected)
+		}
+	}
+
+	var out JoinAddresses
+	if err := json.Unmarshal([]byte(`1`), &out); err == nil {
+		t.Error("expected an error decoding a number")
+	}
+}
+
+// Configurations stored by the baseline agent contain a single
+// retry_join address
+func TestConfiguration_BaselineJSON(t *testing.T) {
+
+	nomad := &NomadConfiguration{}
+	if err := json.Unmarshal([]byte(`{"Name":"edge-01","DataDir":"/opt/nomad","RetryJoin":"10.1.0.1:4647","Meta":{"rack":"b2"}}`), nomad); err != nil {
+		t.Fatal(err)
+	}
+	if nomad.Name != "edge-01" || !reflect.DeepEqual(nomad.RetryJoin, JoinAddresses{"10.1.0.1:4647"}) || nomad.Meta["rack"] != "b2" {
+		t.Fatalf("unexpected nomad configuration: %+v", nomad)
+	}
+
+	consul := &ConsulConfiguration{}
+	if err := json.Unmarshal([]byte(`{"Name":"edge-01","DataDir":"/opt/consul","RetryJoin":"","Meta":null}`), consul); err != nil {
+		t.Fatal(err)
+	}
+	if consul.DataDir != "/opt/consul" || len(consul.RetryJoin) != 0 {
+		t.Fatalf("unexpected consul configuration: %+v", consul)
+	}
+}
@@ -0,0 +1,67 @@
+package structs
+
+// ConsulSettings contains the settings of the Consul agent which
+// can be managed remotely, and which are part of the sync payload.
+type ConsulSettings struct {
+	Datacenter string           `json:"datacenter"`
+	Encrypt    string           `json:"encrypt" diff:"sensitive"`
+	ACL        *ConsulACL       `json:"acl"`
+	TLS        *ConsulTLS       `json:"tls"`
+	Ports      *ConsulPorts     `json:"ports"`
+	Services   []*ConsulService `json:"services"`
+}
+
+// ConsulACL : Consul acl block
+type ConsulACL struct {
+	Enabled                bool             `json:"enabled"`
+	DefaultPolicy          string           `json:"defaultPolicy"`
+	EnableTokenPersistence bool             `json:"enableTokenPersistence"`
+	Tokens                 *ConsulACLTokens `json:"tokens"`
+}
+
+// ConsulACLTokens : Consul acl.tokens block
+type ConsulACLTokens struct {
+	Agent   string `json:"agent" diff:"sensitive"`
+	Default string `json:"default" diff:"sensitive"`
+}
+
+// ConsulTLS contains the PEM-encoded certificate material used by the
+// Consul agent, which is written to files by the client, as well as
+// the verification settings rendered into the configuration.
+type ConsulTLS struct {
+	CA                   string `json:"ca" diff:"sensitive"`
+	Cert                 string `json:"cert" diff:"sensitive"`
+	Key                  string `json:"key" diff:"sensitive"`
+	VerifyIncoming       bool   `json:"verifyIncoming"`
+	VerifyOutgoing       bool   `json:"verifyOutgoing"`
+	VerifyServerHostname bool   `json:"verifyServerHostname"`
+}
+
+// ConsulPorts : Consul ports block. Zero values are not rendered,
+// so that Consul defaults apply, whereas -1 disables a port.
+type ConsulPorts struct {
+	DNS     int `json:"dns"`
+	HTTP    int `json:"http"`
+	HTTPS   int `json:"https"`
+	GRPC    int `json:"grpc"`
+	SerfLAN int `json:"serfLan"`
+	Server  int `json:"server"`
+}
+
+// ConsulService : Consul service definition
+type ConsulService struct {
+	ID    string            `json:"id"`
+	Name  string            `json:"name"`
+	Port  int               `json:"port"`
+	Tags  []string          `json:"tags"`
+	Meta  map[string]string `json:"meta"`
+	Check *ConsulCheck      `json:"check"`
+}
+
+// ConsulCheck : Consul service check. Either HTTP or TCP must be set.
+type ConsulCheck struct {
+	HTTP     string `json:"http"`
+	TCP      string `json:"tcp"`
+	Interval string `json:"interval"`
+	Timeout  string `json:"timeout"`
+}
@@ -132,6 +132,43 @@ type DeviceSyncRequest struct {
 type DeviceSyncResponse struct {
 	*Configuration
 
+	// AgentUpdate advertises the version of the agent the device should run
+	AgentUpdate *AgentUpdate `json:"agentUpdate,omitempty"`
+
+	// Urgent changes are applied outside of maintenance windows
+	Urgent bool `json:"urgent,omitempty"`
+
+	Response
+}
+
+// DeviceHeartbeatRequest :
+type DeviceHeartbeatRequest struct {
+	OrganizationID string
+	ProjectID      string
+	BatchID        string
+	DeviceID       string
+	DeviceRemoteID string
+
+	Heartbeat *DeviceHeartbeat
+
+	QueryOptions
+}
+
+// DeviceHeartbeat is periodically reported by the client to the API
+type DeviceHeartbeat struct {
+	Status           string                  `json:"status"`
+	Modules          []*ModuleStatus         `json:"modules"`
+	Hooks            []*HookStatus           `json:"hooks"`
+	ContainerRuntime *ContainerRuntimeStatus `json:"containerRuntime"`
+	Facts            *DeviceFacts            `json:"facts"`
+	Meta             map[string]string       `json:"meta"`
+	Update           *AgentUpdateStatus      `json:"update,omitempty"`
+	Maintenance      *MaintenanceStatus      `json:"maintenance,omitempty"`
+	Timestamp        time.Time               `json:"timestamp"`
+}
+
+// DeviceHeartbeatResponse :
+type DeviceHeartbeatResponse struct {
 	Response
 }
 
@@ -139,7 +176,26 @@ type DeviceSyncResponse struct {
 type Configuration struct {
 	Labels           map[string]string `json:"labels"`
 	DragoIPAddresses []string          `json:"dragoIpAddresses"`
-	DragoSecret      string            `json:"dragoSecret"`
+	DragoSecret      string            `json:"dragoSecret" diff:"sensitive"`
+
+	// NomadServers and ConsulServers contain the addresses of the
+	// servers the Nomad and Consul agents should join, whereas
+	// NomadRetryJoin and ConsulRetryJoin contain cloud auto-join
+	// strings, e.g. "provider=aws tag_key=... tag_value=...".
+	NomadServers    []string `json:"nomadServers"`
+	NomadRetryJoin  []string `json:"nomadRetryJoin"`
+	ConsulServers   []string `json:"consulServers"`
+	ConsulRetryJoin []string `json:"consulRetryJoin"`
+
+	Nomad  *NomadSettings  `json:"nomad"`
+	Consul *ConsulSettings `json:"consul"`
+
+	Files []*ManagedFile `json:"files"`
+
+	ContainerRuntime *ContainerRuntimeSettings `json:"containerRuntime"`
+
+	// Hooks are only run if allowed by the local client configuration
+	Hooks []*Hook `json:"hooks"`
 }
 
 // Hash returns a unique hash of the struct
@@ -0,0 +1,18 @@
+package structs
+
+import "time"
+
+const (
+	EventTypeInfo    = "info"
+	EventTypeWarning = "warning"
+	EventTypeError   = "error"
+)
+
+// Event represents something noteworthy that happened in the client,
+// such as a configuration being rejected by its validator.
+type Event struct {
+	Type      string
+	Module    string
+	Message   string
+	Timestamp time.Time
+}
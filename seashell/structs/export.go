@@ -0,0 +1,27 @@
+package structs
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// StateExportVersion is the version of the state export format
+const StateExportVersion = 1
+
+// StateExport is a document containing the client state, which can be
+// imported by another client, or by the same client after being reset.
+// Unlike the output of "state show", it contains secrets in clear text.
+type StateExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+
+	// Configurations contains the configuration of each module
+	// as last applied, keyed by module name
+	Configurations map[string]json.RawMessage `json:"configurations"`
+
+	// History contains the configuration versions of each module, from
+	// the oldest to the newest. Versions are renumbered when imported.
+	History map[string][]*ConfigurationVersion `json:"history"`
+
+	Override *ConfigurationOverride `json:"override,omitempty"`
+}
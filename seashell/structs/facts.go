@@ -0,0 +1,111 @@
+package structs
+
+import (
+	"strconv"
+	"time"
+)
+
+// DeviceFacts contains information about the device gathered by the
+// agent, which is reported to the API so that configurations can be
+// targeted, e.g. by hardware class.
+type DeviceFacts struct {
+	Hostname string `json:"hostname"`
+
+	// OS is the operating system, e.g. "linux", whereas Distribution
+	// and DistributionVersion are read from /etc/os-release
+	OS                  string `json:"os"`
+	Distribution        string `json:"distribution,omitempty"`
+	DistributionVersion string `json:"distributionVersion,omitempty"`
+	KernelVersion       string `json:"kernelVersion,omitempty"`
+	Arch                string `json:"arch"`
+
+	CPU     *CPUFacts       `json:"cpu,omitempty"`
+	Memory  *MemoryFacts    `json:"memory,omitempty"`
+	Disk    *DiskFacts      `json:"disk,omitempty"`
+	Network []*NetworkFacts `json:"network,omitempty"`
+	Uptime  int64           `json:"uptime"`
+
+	// Custom contains the facts emitted by the executables of the
+	// facts directory, keyed by "<executable>.<key>"
+	Custom map[string]string `json:"custom,omitempty"`
+
+	Version   string    `json:"agentVersion"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CPUFacts :
+type CPUFacts struct {
+	Count int    `json:"count"`
+	Model string `json:"model,omitempty"`
+}
+
+// MemoryFacts :
+type MemoryFacts struct {
+	TotalBytes     uint64 `json:"totalBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+}
+
+// DiskFacts contains the usage of the
+// filesystem containing the data directory
+type DiskFacts struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"totalBytes"`
+	FreeBytes  uint64 `json:"freeBytes"`
+}
+
+// NetworkFacts contains information about a network interface
+type NetworkFacts struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu,omitempty"`
+	Up        bool     `json:"up"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Map returns the facts as a flat map of strings, e.g. for interpolation,
+// keyed by their JSON names. Nested facts are joined with dots,
+// e.g. "cpu.count", and interfaces are keyed by name, e.g. "network.eth0.mac".
+func (f *DeviceFacts) Map() map[string]string {
+
+	out := map[string]string{
+		"hostname":            f.Hostname,
+		"os":                  f.OS,
+		"distribution":        f.Distribution,
+		"distributionVersion": f.DistributionVersion,
+		"kernelVersion":       f.KernelVersion,
+		"arch":                f.Arch,
+		"uptime":              strconv.FormatInt(f.Uptime, 10),
+		"agentVersion":        f.Version,
+	}
+
+	if f.CPU != nil {
+		out["cpu.count"] = strconv.Itoa(f.CPU.Count)
+		out["cpu.model"] = f.CPU.Model
+	}
+
+	if f.Memory != nil {
+		out["memory.totalBytes"] = strconv.FormatUint(f.Memory.TotalBytes, 10)
+		out["memory.availableBytes"] = strconv.FormatUint(f.Memory.AvailableBytes, 10)
+	}
+
+	if f.Disk != nil {
+		out["disk.totalBytes"] = strconv.FormatUint(f.Disk.TotalBytes, 10)
+		out["disk.freeBytes"] = strconv.FormatUint(f.Disk.FreeBytes, 10)
+	}
+
+	for _, n := range f.Network {
+		out["network."+n.Name+".mac"] = n.MAC
+		if len(n.Addresses) > 0 {
+			out["network."+n.Name+".address"] = n.Addresses[0]
+		}
+	}
+
+	// Custom facts never shadow the facts collected by the agent
+	for k, v := range f.Custom {
+		if _, ok := out[k]; !ok {
+			out[k] = v
+		}
+	}
+
+	return out
+}
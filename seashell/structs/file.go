@@ -0,0 +1,21 @@
+package structs
+
+// ManagedFile is an arbitrary file managed by the client, e.g. a CA
+// certificate or a sysctl snippet. Its content is given either verbatim,
+// or as a template rendered with the device name and labels.
+type ManagedFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content" diff:"sensitive"`
+	Template string `json:"template" diff:"sensitive"`
+
+	// Mode is the octal file mode, e.g. "0644"
+	Mode string `json:"mode"`
+
+	// Owner is the owner of the file, in the format "user[:group]"
+	Owner string `json:"owner"`
+
+	// Checksum is the hex-encoded SHA-256 checksum of the rendered
+	// content. If set in the sync payload, it is verified before
+	// the file is written.
+	Checksum string `json:"checksum"`
+}
@@ -0,0 +1,87 @@
+package structs
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	HookTriggerOnChange = "on_change"
+	HookTriggerOnStart  = "on_start"
+	HookTriggerPeriodic = "periodic"
+)
+
+const (
+	HookSourceLocal  = "local"
+	HookSourceRemote = "remote"
+)
+
+// Hook is a command run by the client when the rendered output of a
+// module changes, when the client starts, or periodically.
+type Hook struct {
+	Name    string `json:"name"`
+	Trigger string `json:"trigger"`
+
+	// Module is the module whose changes trigger on_change hooks
+	Module string `json:"module"`
+
+	// Command is run through the shell, i.e. "/bin/sh -c <command>"
+	Command string `json:"command"`
+
+	// Interval is the interval between runs of periodic hooks, e.g. "5m"
+	Interval string `json:"interval"`
+
+	// Timeout is the maximum duration of a run, e.g. "30s"
+	Timeout string `json:"timeout"`
+
+	// Env contains additional environment variables
+	Env map[string]string `json:"env"`
+
+	Source string `json:"-"`
+}
+
+// Validate returns an error in case the hook is not valid
+func (h *Hook) Validate() error {
+
+	if h.Name == "" {
+		return fmt.Errorf("hook name is required")
+	}
+
+	if h.Command == "" {
+		return fmt.Errorf("hook %s: command is required", h.Name)
+	}
+
+	switch h.Trigger {
+	case HookTriggerOnChange:
+		if h.Module == "" {
+			return fmt.Errorf("hook %s: module is required for %s hooks", h.Name, h.Trigger)
+		}
+	case HookTriggerOnStart:
+	case HookTriggerPeriodic:
+		d, err := time.ParseDuration(h.Interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("hook %s: invalid interval %q", h.Name, h.Interval)
+		}
+	default:
+		return fmt.Errorf("hook %s: unknown trigger %q", h.Name, h.Trigger)
+	}
+
+	if h.Timeout != "" {
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("hook %s: invalid timeout %q", h.Name, h.Timeout)
+		}
+	}
+
+	return nil
+}
+
+// HookStatus contains the result of the latest run of a hook
+type HookStatus struct {
+	Name     string        `json:"name"`
+	Source   string        `json:"source"`
+	Trigger  string        `json:"trigger"`
+	LastRun  time.Time     `json:"lastRun"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exitCode"`
+	Error    string        `json:"error,omitempty"`
+}
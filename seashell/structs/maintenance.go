@@ -0,0 +1,23 @@
+package structs
+
+import (
+	"time"
+)
+
+// PendingConfiguration is a configuration received from the API outside
+// of the maintenance windows of the device, which is held in the client
+// state until a window opens or it is applied on demand.
+type PendingConfiguration struct {
+	Configuration *Configuration    `json:"configuration"`
+	Meta          map[string]string `json:"meta,omitempty"`
+	ReceivedAt    time.Time         `json:"receivedAt"`
+}
+
+// MaintenanceStatus reports whether changes can currently be applied
+// and, if not, since when a configuration has been pending
+type MaintenanceStatus struct {
+	InWindow     bool       `json:"inWindow"`
+	NextWindow   *time.Time `json:"nextWindow,omitempty"`
+	PendingSince *time.Time `json:"pendingSince,omitempty"`
+	PendingHash  string     `json:"pendingHash,omitempty"`
+}
@@ -0,0 +1,44 @@
+package structs
+
+import "time"
+
+const (
+	ModuleStatePending   = "pending"
+	ModuleStateHealthy   = "healthy"
+	ModuleStateUnhealthy = "unhealthy"
+	ModuleStateBlocked   = "blocked"
+	ModuleStateFailed    = "failed"
+)
+
+// ModuleStatus contains the reconciliation status of a module
+type ModuleStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+
+	// Dependencies are the modules which must be healthy
+	// before the module can be reconciled
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	// BlockedBy contains the dependencies which are not healthy,
+	// in case the module is blocked
+	BlockedBy []string `json:"blockedBy,omitempty"`
+
+	Error string `json:"error,omitempty"`
+
+	// LastAttempt and LastSuccess are the times at which the module was
+	// last reconciled, and last reconciled without errors, respectively
+	LastAttempt *time.Time `json:"lastAttempt,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+
+	// ConsecutiveFailures is the number of reconciliations of the module
+	// which failed since the last successful one
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+
+	// LastError is the error of the last failed reconciliation, which
+	// is kept after the module is successfully reconciled again
+	LastError string `json:"lastError,omitempty"`
+
+	// NextAttempt is the time before which a failed module
+	// is not retried, unless its configuration changes
+	NextAttempt *time.Time `json:"nextAttempt,omitempty"`
+}
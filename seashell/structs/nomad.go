@@ -0,0 +1,69 @@
+package structs
+
+// NomadSettings contains the settings of the Nomad client which
+// can be managed remotely, and which are part of the sync payload.
+type NomadSettings struct {
+	Region          string                  `json:"region"`
+	Datacenter      string                  `json:"datacenter"`
+	NodeClass       string                  `json:"nodeClass"`
+	HostVolumes     []*NomadHostVolume      `json:"hostVolumes"`
+	HostNetworks    []*NomadHostNetwork     `json:"hostNetworks"`
+	Reserved        *NomadReservedResources `json:"reserved"`
+	DriverAllowlist []string                `json:"driverAllowlist"`
+	DriverDenylist  []string                `json:"driverDenylist"`
+	Plugins         []*NomadPlugin          `json:"plugins"`
+	ACL             *NomadACL               `json:"acl"`
+	TLS             *NomadTLS               `json:"tls"`
+	ServerJoin      *NomadServerJoin        `json:"serverJoin"`
+}
+
+// NomadHostVolume : Nomad client host_volume block
+type NomadHostVolume struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// NomadHostNetwork : Nomad client host_network block
+type NomadHostNetwork struct {
+	Name          string `json:"name"`
+	Interface     string `json:"interface"`
+	CIDR          string `json:"cidr"`
+	ReservedPorts string `json:"reservedPorts"`
+}
+
+// NomadReservedResources : Nomad client reserved block
+type NomadReservedResources struct {
+	CPU           int    `json:"cpu"`
+	Memory        int    `json:"memory"`
+	Disk          int    `json:"disk"`
+	ReservedPorts string `json:"reservedPorts"`
+}
+
+// NomadPlugin : Nomad plugin block, whose config is plugin-specific
+type NomadPlugin struct {
+	Name   string                 `json:"name"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// NomadACL : Nomad acl block
+type NomadACL struct {
+	Enabled bool `json:"enabled"`
+}
+
+// NomadTLS : Nomad tls block
+type NomadTLS struct {
+	HTTP                 bool   `json:"http"`
+	RPC                  bool   `json:"rpc"`
+	CAFile               string `json:"caFile"`
+	CertFile             string `json:"certFile"`
+	KeyFile              string `json:"keyFile"`
+	VerifyServerHostname bool   `json:"verifyServerHostname"`
+}
+
+// NomadServerJoin : Nomad server_join block. The addresses to join
+// are kept in the RetryJoin field of the Nomad configuration.
+type NomadServerJoin struct {
+	RetryInterval string `json:"retryInterval"`
+	RetryMax      int    `json:"retryMax"`
+}
@@ -0,0 +1,130 @@
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	OverrideSourceFile = "file"
+	OverrideSourceAPI  = "api"
+)
+
+// overrideForbiddenKeys are the keys of the Configuration struct which
+// cannot be overridden locally, e.g. hooks, which would otherwise allow
+// anyone able to set an override to run commands as the agent.
+var overrideForbiddenKeys = []string{"hooks"}
+
+// ConfigurationOverride is a local layer of configuration which is
+// deep-merged over the configuration received from the API. Its values
+// are keyed by the JSON field names of the Configuration struct.
+type ConfigurationOverride struct {
+	Source    string
+	Values    map[string]interface{}
+	ExpiresAt *time.Time `json:",omitempty"`
+	UpdatedAt time.Time
+}
+
+// Expired returns true if the override has an expiry time in the past
+func (o *ConfigurationOverride) Expired(now time.Time) bool {
+	return o.ExpiresAt != nil && now.After(*o.ExpiresAt)
+}
+
+// Validate returns an error in case the override contains values which
+// do not correspond to any field of the Configuration struct, or whose
+// types are not compatible with those fields, or which override fields
+// that cannot be overridden locally.
+func (o *ConfigurationOverride) Validate() error {
+
+	known, err := toMap(&Configuration{})
+	if err != nil {
+		return err
+	}
+
+	unknown := []string{}
+	for k := range o.Values {
+		if _, ok := known[k]; !ok {
+			unknown = append(unknown, k)
+		}
+	}
+
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return NewInvalidInputError(fmt.Sprintf("unknown configuration keys: %s", strings.Join(unknown, ", ")))
+	}
+
+	forbidden := []string{}
+	for _, k := range overrideForbiddenKeys {
+		if _, ok := o.Values[k]; ok {
+			forbidden = append(forbidden, k)
+		}
+	}
+
+	if len(forbidden) > 0 {
+		return NewInvalidInputError(fmt.Sprintf("configuration keys cannot be overridden: %s", strings.Join(forbidden, ", ")))
+	}
+
+	if _, err := (&Configuration{}).Override(o); err != nil {
+		return NewInvalidInputError(err.Error())
+	}
+
+	return nil
+}
+
+// Override returns a copy of the configuration with the values of
+// the override deep-merged over it. Nested objects are merged key by
+// key, whereas any other values, including lists, are replaced.
+func (c *Configuration) Override(o *ConfigurationOverride) (*Configuration, error) {
+
+	base, err := toMap(c)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := deepMerge(base, o.Values)
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &Configuration{}
+	if err := json.Unmarshal(encoded, out); err != nil {
+		return nil, fmt.Errorf("invalid override: %v", err)
+	}
+
+	return out, nil
+}
+
+func toMap(in interface{}) (map[string]interface{}, error) {
+
+	encoded, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func deepMerge(dst, src map[string]interface{}) map[string]interface{} {
+
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]interface{})
+		dstMap, dstOk := dst[k].(map[string]interface{})
+		if srcOk && dstOk {
+			dst[k] = deepMerge(dstMap, srcMap)
+		} else {
+			dst[k] = v
+		}
+	}
+
+	return dst
+}
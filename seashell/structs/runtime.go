@@ -0,0 +1,22 @@
+package structs
+
+import "time"
+
+// ContainerRuntimeSettings contains the settings of the container
+// runtime which are part of the sync payload, and which are rendered
+// into the Docker daemon configuration, i.e. daemon.json.
+type ContainerRuntimeSettings struct {
+	RegistryMirrors    []string          `json:"registryMirrors"`
+	InsecureRegistries []string          `json:"insecureRegistries"`
+	LogDriver          string            `json:"logDriver"`
+	LogOpts            map[string]string `json:"logOpts"`
+	StorageDriver      string            `json:"storageDriver"`
+}
+
+// ContainerRuntimeStatus contains the status of the container runtime
+type ContainerRuntimeStatus struct {
+	Socket      string     `json:"socket"`
+	Reachable   bool       `json:"reachable"`
+	Error       string     `json:"error,omitempty"`
+	LastRestart *time.Time `json:"lastRestart,omitempty"`
+}
@@ -6,3 +6,18 @@ type StatusVersionResponse struct {
 
 	QueryOptions
 }
+
+// ClientStatus contains the status of the Seashell client
+type ClientStatus struct {
+	DeviceID    string
+	Status      string
+	Modules     []*ModuleStatus
+	Interfaces  []*WireguardInterface
+	Hooks       []*HookStatus
+	Runtime     *ContainerRuntimeStatus
+	Facts       *DeviceFacts
+	Update      *AgentUpdateStatus
+	Maintenance *MaintenanceStatus
+	Overrides   []*ConfigurationOverride
+	Events      []*Event
+}
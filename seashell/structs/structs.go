@@ -19,6 +19,14 @@ type WriteRequest struct {
 
 // Response contains information that is common to all responses.
 type Response struct {
+	// Meta contains metadata about the response, such as
+	// the values of relevant HTTP headers.
+	Meta map[string]string `json:"-"`
+}
+
+// SetMeta sets the response metadata
+func (r *Response) SetMeta(meta map[string]string) {
+	r.Meta = meta
 }
 
 // GenericRequest is used to request where no
@@ -0,0 +1,69 @@
+package structs
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// AgentUpdateStateDownloading indicates that the binary
+	// of the target version is being downloaded and verified
+	AgentUpdateStateDownloading = "downloading"
+
+	// AgentUpdateStatePending indicates that the binary was replaced,
+	// and that the new version has yet to become ready
+	AgentUpdateStatePending = "pending"
+
+	// AgentUpdateStateCompleted indicates that the new version became ready
+	AgentUpdateStateCompleted = "completed"
+
+	// AgentUpdateStateFailed indicates that the binary of the target
+	// version could not be downloaded, verified or installed
+	AgentUpdateStateFailed = "failed"
+
+	// AgentUpdateStateRolledBack indicates that the new version did not
+	// become ready in time, and that the previous binary was restored
+	AgentUpdateStateRolledBack = "rolled_back"
+)
+
+// AgentUpdate advertises the version of the agent a device should run. The
+// signature is an ed25519 signature of the message returned by SignedMessage,
+// which binds the version to the SHA-256 digest of the binary.
+type AgentUpdate struct {
+	Version   string   `json:"version"`
+	URLs      []string `json:"urls"`
+	SHA256    string   `json:"sha256"`
+	Signature string   `json:"signature"`
+}
+
+// SignedMessage returns the message signed by the update signature,
+// i.e. "<version> <hex-encoded SHA-256 digest>"
+func (u *AgentUpdate) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("%s %s", u.Version, u.SHA256))
+}
+
+// Validate returns an error in case the update is invalid
+func (u *AgentUpdate) Validate() error {
+	if u.Version == "" {
+		return fmt.Errorf("missing version")
+	}
+	if len(u.URLs) == 0 {
+		return fmt.Errorf("missing download URLs")
+	}
+	if len(u.SHA256) != 64 {
+		return fmt.Errorf("invalid SHA-256 digest %q", u.SHA256)
+	}
+	if u.Signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	return nil
+}
+
+// AgentUpdateStatus contains the state of the latest update of the agent
+type AgentUpdateStatus struct {
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previousVersion,omitempty"`
+	State           string    `json:"state"`
+	Error           string    `json:"error,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
@@ -0,0 +1,24 @@
+package structs
+
+import "time"
+
+// WireguardInterface contains the state of a WireGuard interface
+// managed by Drago, as reported by the kernel.
+type WireguardInterface struct {
+	Name       string
+	PublicKey  string
+	ListenPort int
+	Peers      []*WireguardPeer
+}
+
+// WireguardPeer contains the state of a peer of a WireGuard interface
+type WireguardPeer struct {
+	PublicKey           string
+	Endpoint            string
+	AllowedIPs          []string
+	LatestHandshake     *time.Time `json:",omitempty"`
+	HandshakeAge        string     `json:",omitempty"`
+	ReceiveBytes        int64
+	TransmitBytes       int64
+	PersistentKeepalive int
+}